@@ -0,0 +1,448 @@
+package kube_builders
+
+import (
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	kube_errors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+var autoscalerKind = schema.GroupVersionKind{Group: "autoscaling", Version: "v2beta2", Kind: "HorizontalPodAutoscaler"}
+
+// scaling policy types of autoscaling/v2beta2
+const (
+	PodsScalingPolicy    = "Pods"
+	PercentScalingPolicy = "Percent"
+)
+
+// AutoscalerBuilder builds an autoscaling/v2beta2 HorizontalPodAutoscaler for a deployment. Our typed
+// client only knows v2alpha1, which has no external metrics or scaling behavior, so autoscalers are pushed
+// through the dynamic client of the target like Gateway API objects. Servers from kubernetes 1.12 to 1.25
+// serve v2beta2, and the deployments of this package are served up to 1.15; scaling behavior needs 1.18,
+// older servers drop it.
+type AutoscalerBuilder struct {
+	kube *KubeTarget
+
+	name      string
+	namespace string
+
+	target                   autoscalerObjectRef
+	minReplicas, maxReplicas int
+	metrics                  []autoscalerMetric
+	scaleUp, scaleDown       *ScalingRulesBuilder
+
+	labels      map[string]string
+	annotations map[string]string
+
+	deployment DeploymentBuilder
+}
+
+// ScalingRulesBuilder configures how fast an autoscaler scales in one direction. Without policies the
+// defaults of the server are used.
+type ScalingRulesBuilder struct {
+	stabilizationSeconds *int
+	selectPolicy         string
+	policies             []scalingPolicy
+}
+
+type autoscalerSpec struct {
+	ScaleTargetRef autoscalerObjectRef `json:"scaleTargetRef"`
+	MinReplicas    int                 `json:"minReplicas"`
+	MaxReplicas    int                 `json:"maxReplicas"`
+	Metrics        []autoscalerMetric  `json:"metrics"`
+	Behavior       *autoscalerBehavior `json:"behavior,omitempty"`
+}
+
+type autoscalerObjectRef struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Name       string `json:"name"`
+}
+
+type autoscalerMetric struct {
+	Type     string          `json:"type"`
+	Resource *resourceMetric `json:"resource,omitempty"`
+	Pods     *podsMetric     `json:"pods,omitempty"`
+	Object   *objectMetric   `json:"object,omitempty"`
+	External *externalMetric `json:"external,omitempty"`
+}
+
+type resourceMetric struct {
+	Name   v1.ResourceName `json:"name"`
+	Target metricTarget    `json:"target"`
+}
+
+type podsMetric struct {
+	Metric metricIdentifier `json:"metric"`
+	Target metricTarget     `json:"target"`
+}
+
+type objectMetric struct {
+	DescribedObject autoscalerObjectRef `json:"describedObject"`
+	Metric          metricIdentifier    `json:"metric"`
+	Target          metricTarget        `json:"target"`
+}
+
+type externalMetric struct {
+	Metric metricIdentifier `json:"metric"`
+	Target metricTarget     `json:"target"`
+}
+
+type metricIdentifier struct {
+	Name     string                 `json:"name"`
+	Selector *meta_v1.LabelSelector `json:"selector,omitempty"`
+}
+
+type metricTarget struct {
+	Type               string             `json:"type"`
+	Value              *resource.Quantity `json:"value,omitempty"`
+	AverageValue       *resource.Quantity `json:"averageValue,omitempty"`
+	AverageUtilization *int               `json:"averageUtilization,omitempty"`
+
+	// set when the value given for the target isn't a quantity, and returned by AsKube
+	err error
+}
+
+type autoscalerBehavior struct {
+	ScaleUp   scalingRules `json:"scaleUp"`
+	ScaleDown scalingRules `json:"scaleDown"`
+}
+
+type scalingRules struct {
+	StabilizationWindowSeconds int             `json:"stabilizationWindowSeconds"`
+	SelectPolicy               string          `json:"selectPolicy"`
+	Policies                   []scalingPolicy `json:"policies"`
+}
+
+type scalingPolicy struct {
+	Type          string `json:"type"`
+	Value         int    `json:"value"`
+	PeriodSeconds int    `json:"periodSeconds"`
+}
+
+// Autoscale returns an autoscaler for the deployment, named after it, which keeps its replicas between
+// min and max. Once the autoscaler exists, pushing the deployment leaves its replicas alone.
+func (deployment DeploymentBuilder) Autoscale(min, max int) (hpa AutoscalerBuilder) {
+	deployment.autoscaled = true
+	deployment.minReplicas = min
+
+	hpa.kube = deployment.kube
+	hpa.name = deployment.name
+	hpa.namespace = deployment.namespace
+	hpa.target = autoscalerObjectRef{
+		Kind: "Deployment",
+		Name: deployment.name,
+		// served by every server which serves v2beta2, unlike extensions/v1beta1
+		APIVersion: "apps/v1",
+	}
+	hpa.minReplicas = min
+	hpa.maxReplicas = max
+	hpa.deployment = deployment
+	return
+}
+
+// Deployment returns the autoscaled deployment. It is created with the minimum number of replicas, after
+// which pushing it leaves the replicas to the autoscaler, even when the autoscaler isn't pushed yet.
+func (hpa AutoscalerBuilder) Deployment() DeploymentBuilder {
+	return hpa.deployment
+}
+
+func (hpa AutoscalerBuilder) Label(label string, value interface{}) AutoscalerBuilder {
+	setAtMap(&hpa.labels, label, value)
+	return hpa
+}
+
+func (hpa AutoscalerBuilder) Annotation(annotation string, value interface{}) AutoscalerBuilder {
+	setAtMap(&hpa.annotations, annotation, value)
+	return hpa
+}
+
+// CPUUtilization targets an average CPU usage across pods, as a percentage of the CPU they request.
+func (hpa AutoscalerBuilder) CPUUtilization(percent int) AutoscalerBuilder {
+	return hpa.resourceUtilization(v1.ResourceCPU, percent)
+}
+
+// MemoryUtilization targets an average memory usage across pods, as a percentage of the memory they
+// request.
+func (hpa AutoscalerBuilder) MemoryUtilization(percent int) AutoscalerBuilder {
+	return hpa.resourceUtilization(v1.ResourceMemory, percent)
+}
+
+func (hpa AutoscalerBuilder) resourceUtilization(name v1.ResourceName, percent int) AutoscalerBuilder {
+	hpa.metrics = hpa.setMetric(autoscalerMetric{
+		Type:     "Resource",
+		Resource: &resourceMetric{Name: name, Target: metricTarget{Type: "Utilization", AverageUtilization: &percent}},
+	})
+	return hpa
+}
+
+// PodsMetric targets an average value of a custom metric reported by each pod. The value is a quantity
+// such as "100" or "500m"; an invalid one is reported when the autoscaler is built.
+func (hpa AutoscalerBuilder) PodsMetric(metric, averageValue string) AutoscalerBuilder {
+	hpa.metrics = hpa.setMetric(autoscalerMetric{
+		Type: "Pods",
+		Pods: &podsMetric{Metric: metricIdentifier{Name: metric}, Target: averageValueTarget(averageValue)},
+	})
+	return hpa
+}
+
+// ObjectMetric targets the value of a custom metric describing another object in the namespace, such as
+// the requests per second of an ingress. The value is a quantity, like for PodsMetric.
+func (hpa AutoscalerBuilder) ObjectMetric(apiVersion, kind, name, metric, value string) AutoscalerBuilder {
+	hpa.metrics = hpa.setMetric(autoscalerMetric{
+		Type: "Object",
+		Object: &objectMetric{
+			DescribedObject: autoscalerObjectRef{APIVersion: apiVersion, Kind: kind, Name: name},
+			Metric:          metricIdentifier{Name: metric},
+			Target:          valueTarget(value),
+		},
+	})
+	return hpa
+}
+
+// ExternalMetric targets the total value of a metric from outside the cluster, such as the length of a
+// hosted queue, narrowed down by selector when it isn't empty. The value is a quantity, like for
+// PodsMetric.
+func (hpa AutoscalerBuilder) ExternalMetric(metric string, selector map[string]string, value string) AutoscalerBuilder {
+	return hpa.externalMetric(metric, selector, valueTarget(value))
+}
+
+// ExternalAverageMetric targets the value of a metric from outside the cluster divided by the number of
+// pods, narrowed down by selector when it isn't empty. The value is a quantity, like for PodsMetric.
+func (hpa AutoscalerBuilder) ExternalAverageMetric(metric string, selector map[string]string, averageValue string) AutoscalerBuilder {
+	return hpa.externalMetric(metric, selector, averageValueTarget(averageValue))
+}
+
+func (hpa AutoscalerBuilder) externalMetric(metric string, selector map[string]string, target metricTarget) AutoscalerBuilder {
+	identifier := metricIdentifier{Name: metric}
+	if len(selector) > 0 {
+		identifier.Selector = &meta_v1.LabelSelector{MatchLabels: copyMap(selector)}
+	}
+	hpa.metrics = hpa.setMetric(autoscalerMetric{
+		Type:     "External",
+		External: &externalMetric{Metric: identifier, Target: target},
+	})
+	return hpa
+}
+
+func valueTarget(value string) metricTarget {
+	quantity, err := resource.ParseQuantity(value)
+	if err != nil {
+		return metricTarget{Type: "Value", err: errors.Wrapf(err, "invalid target value %q", value)}
+	}
+	return metricTarget{Type: "Value", Value: &quantity}
+}
+
+func averageValueTarget(averageValue string) metricTarget {
+	quantity, err := resource.ParseQuantity(averageValue)
+	if err != nil {
+		return metricTarget{Type: "AverageValue", err: errors.Wrapf(err, "invalid target value %q", averageValue)}
+	}
+	return metricTarget{Type: "AverageValue", AverageValue: &quantity}
+}
+
+// targetErr returns the error of an invalid target value of the metric.
+func targetErr(spec autoscalerMetric) error {
+	switch {
+	case spec.Pods != nil:
+		return spec.Pods.Target.err
+	case spec.Object != nil:
+		return spec.Object.Target.err
+	case spec.External != nil:
+		return spec.External.Target.err
+	}
+	return nil
+}
+
+// setMetric returns the metrics with the target for the same metric replaced, or added.
+func (hpa AutoscalerBuilder) setMetric(spec autoscalerMetric) []autoscalerMetric {
+	metrics := append([]autoscalerMetric(nil), hpa.metrics...)
+	for i, existing := range metrics {
+		if metricKey(existing) == metricKey(spec) {
+			metrics[i] = spec
+			return metrics
+		}
+	}
+	return append(metrics, spec)
+}
+
+func metricKey(spec autoscalerMetric) string {
+	switch {
+	case spec.Resource != nil:
+		return "resource/" + string(spec.Resource.Name)
+	case spec.Pods != nil:
+		return "pods/" + spec.Pods.Metric.Name
+	case spec.Object != nil:
+		described := spec.Object.DescribedObject
+		return "object/" + described.APIVersion + "/" + described.Kind + "/" + described.Name + "/" + spec.Object.Metric.Name
+	case spec.External != nil:
+		key := "external/" + spec.External.Metric.Name
+		if selector := spec.External.Metric.Selector; selector != nil {
+			var labels []string
+			for label, value := range selector.MatchLabels {
+				labels = append(labels, label+"="+value)
+			}
+			sort.Strings(labels)
+			key += "/" + strings.Join(labels, ",")
+		}
+		return key
+	}
+	return spec.Type
+}
+
+// ScaleUp configures how fast the autoscaler adds pods.
+func (hpa AutoscalerBuilder) ScaleUp(builder func(ScalingRulesBuilder) ScalingRulesBuilder) AutoscalerBuilder {
+	rules := builder(ScalingRulesBuilder{})
+	hpa.scaleUp = &rules
+	return hpa
+}
+
+// ScaleDown configures how fast the autoscaler removes pods.
+func (hpa AutoscalerBuilder) ScaleDown(builder func(ScalingRulesBuilder) ScalingRulesBuilder) AutoscalerBuilder {
+	rules := builder(ScalingRulesBuilder{})
+	hpa.scaleDown = &rules
+	return hpa
+}
+
+// Stabilization makes the autoscaler act on the most conservative recommendation of the last seconds, so
+// a short spike or dip doesn't scale the deployment back and forth.
+func (rules ScalingRulesBuilder) Stabilization(seconds int) ScalingRulesBuilder {
+	rules.stabilizationSeconds = &seconds
+	return rules
+}
+
+// Pods allows changing the replicas by at most pods within periodSeconds.
+func (rules ScalingRulesBuilder) Pods(pods, periodSeconds int) ScalingRulesBuilder {
+	return rules.policy(scalingPolicy{Type: PodsScalingPolicy, Value: pods, PeriodSeconds: periodSeconds})
+}
+
+// Percent allows changing the replicas by at most percent of the current replicas within periodSeconds.
+func (rules ScalingRulesBuilder) Percent(percent, periodSeconds int) ScalingRulesBuilder {
+	return rules.policy(scalingPolicy{Type: PercentScalingPolicy, Value: percent, PeriodSeconds: periodSeconds})
+}
+
+func (rules ScalingRulesBuilder) policy(policy scalingPolicy) ScalingRulesBuilder {
+	rules.policies = append(append([]scalingPolicy(nil), rules.policies...), policy)
+	return rules
+}
+
+// SelectMin applies the policy allowing the smallest change, instead of the largest.
+func (rules ScalingRulesBuilder) SelectMin() ScalingRulesBuilder {
+	rules.selectPolicy = "Min"
+	return rules
+}
+
+// Disabled stops the autoscaler from scaling in this direction at all.
+func (rules ScalingRulesBuilder) Disabled() ScalingRulesBuilder {
+	rules.selectPolicy = "Disabled"
+	return rules
+}
+
+// asKube spells out every field the server would default, so a pushed autoscaler compares equal to the
+// live one. These are the defaults of autoscaling/v2beta2.
+func (rules *ScalingRulesBuilder) asKube(up bool) (kubeRules scalingRules) {
+	kubeRules.SelectPolicy = "Max"
+	if up {
+		kubeRules.Policies = []scalingPolicy{
+			{Type: PodsScalingPolicy, Value: 4, PeriodSeconds: 15},
+			{Type: PercentScalingPolicy, Value: 100, PeriodSeconds: 15},
+		}
+	} else {
+		kubeRules.StabilizationWindowSeconds = 300
+		kubeRules.Policies = []scalingPolicy{{Type: PercentScalingPolicy, Value: 100, PeriodSeconds: 15}}
+	}
+	if rules == nil {
+		return
+	}
+
+	if rules.stabilizationSeconds != nil {
+		kubeRules.StabilizationWindowSeconds = *rules.stabilizationSeconds
+	}
+	if len(rules.selectPolicy) > 0 {
+		kubeRules.SelectPolicy = rules.selectPolicy
+	}
+	if len(rules.policies) > 0 {
+		kubeRules.Policies = rules.policies
+	}
+	return
+}
+
+// AsKube builds the autoscaler. Fields the server defaults, such as the CPU target used without any
+// metrics, are filled in the same way. Metric targets which aren't quantities are reported as errors.
+func (hpa AutoscalerBuilder) AsKube() (*unstructured.Unstructured, error) {
+	for _, metric := range hpa.metrics {
+		if err := targetErr(metric); err != nil {
+			return nil, errors.Wrapf(err, "autoscaler %s: metric %s", hpa.name, metricKey(metric))
+		}
+	}
+	meta := meta_v1.ObjectMeta{Name: hpa.name, Namespace: hpa.namespace, Labels: hpa.labels, Annotations: hpa.annotations}
+	hpa.kube.stampProvenance(&meta)
+
+	spec := autoscalerSpec{
+		ScaleTargetRef: hpa.target,
+		MinReplicas:    hpa.minReplicas,
+		MaxReplicas:    hpa.maxReplicas,
+		Metrics:        hpa.metrics,
+	}
+	if spec.MinReplicas < 1 {
+		spec.MinReplicas = 1
+	}
+	if len(spec.Metrics) == 0 {
+		spec.Metrics = hpa.CPUUtilization(80).metrics
+	}
+	if hpa.scaleUp != nil || hpa.scaleDown != nil {
+		spec.Behavior = &autoscalerBehavior{ScaleUp: hpa.scaleUp.asKube(true), ScaleDown: hpa.scaleDown.asKube(false)}
+	}
+	return toUnstructured(autoscalerKind, meta, spec)
+}
+
+func (hpa AutoscalerBuilder) Render(w io.Writer, format Format) error {
+	obj, err := hpa.AsKube()
+	if err != nil {
+		return err
+	}
+	return Render(w, format, obj)
+}
+
+func (hpa AutoscalerBuilder) Diff() (diff ObjectDiff, err error) {
+	obj, err := hpa.AsKube()
+	if err != nil {
+		return
+	}
+	return hpa.kube.diff(obj)
+}
+
+func (hpa AutoscalerBuilder) Push() (obj *unstructured.Unstructured, result PushResult, err error) {
+	if obj, err = hpa.AsKube(); err != nil {
+		return
+	}
+	return pushUnstructured(hpa.kube, obj, autoscalerKind, "horizontal pod autoscaler", "horizontalpodautoscalers")
+}
+
+// deploymentAutoscaled tells whether an autoscaler scales the deployment. Autoscalers are listed through
+// autoscaling/v1, which serves them whichever version they were created with. Callers which may not list
+// autoscalers, or servers without them, are taken to have none.
+func deploymentAutoscaled(iface kubernetes.Interface, namespace, name string) (autoscaled bool, err error) {
+	hpas, err := iface.AutoscalingV1().HorizontalPodAutoscalers(namespace).List(meta_v1.ListOptions{})
+	if kube_errors.IsForbidden(err) || kube_errors.IsNotFound(err) {
+		return false, nil
+	} else if err != nil {
+		err = errors.Wrapf(err, "failed to list autoscalers of deployment %s", name)
+		return
+	}
+	for _, hpa := range hpas.Items {
+		target := hpa.Spec.ScaleTargetRef
+		if target.Kind == "Deployment" && target.Name == name {
+			return true, nil
+		}
+	}
+	return
+}
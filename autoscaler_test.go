@@ -0,0 +1,189 @@
+package kube_builders_test
+
+import (
+	"errors"
+
+	. "github.com/Twister915/kube_builders"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	kube_errors "k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	autoscaling_v1 "k8s.io/client-go/pkg/apis/autoscaling/v1"
+	core "k8s.io/client-go/testing"
+)
+
+var _ = Describe("Autoscaler", func() {
+	const (
+		namespace = "test"
+		name      = "test"
+	)
+
+	var (
+		fakeKubernetes kubernetes.Interface
+		kubeTarget     *KubeTarget
+	)
+
+	deploy := func() DeploymentBuilder {
+		return kubeTarget.NewPod("", namespace).Container("web", "image", func(ctr ContainerBuilder) ContainerBuilder {
+			return ctr
+		}).Deployment(name)
+	}
+
+	autoscale := func() AutoscalerBuilder {
+		return deploy().Autoscale(2, 10)
+	}
+
+	scaleLive := func(replicas int32) {
+		live, err := fakeKubernetes.ExtensionsV1beta1().Deployments(namespace).Get(name, meta_v1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		live.Spec.Replicas = &replicas
+		_, err = fakeKubernetes.ExtensionsV1beta1().Deployments(namespace).Update(live)
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	liveReplicas := func() int32 {
+		live, err := fakeKubernetes.ExtensionsV1beta1().Deployments(namespace).Get(name, meta_v1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		return *live.Spec.Replicas
+	}
+
+	BeforeEach(func() {
+		fakeKubernetes = fake.NewSimpleClientset()
+		kubeTarget = NewKubeTarget(fakeKubernetes)
+	})
+
+	It("targets the deployment", func() {
+		hpa := built(autoscale().CPUUtilization(50).CPUUtilization(70).MemoryUtilization(80).PodsMetric("queue_length", "30").AsKube())
+
+		Expect(hpa.GetName()).To(Equal(name))
+		Expect(hpa.GetAPIVersion()).To(Equal("autoscaling/v2beta2"))
+		Expect(field(hpa.Object, "spec", "scaleTargetRef")).To(Equal(map[string]interface{}{
+			"apiVersion": "apps/v1", "kind": "Deployment", "name": name,
+		}))
+		Expect(field(hpa.Object, "spec", "minReplicas")).To(BeEquivalentTo(2))
+		Expect(field(hpa.Object, "spec", "maxReplicas")).To(BeEquivalentTo(10))
+
+		By("replacing targets for the same metric")
+		Expect(field(hpa.Object, "spec", "metrics")).To(HaveLen(3))
+		Expect(field(hpa.Object, "spec", "metrics", 0, "resource", "name")).To(Equal("cpu"))
+		Expect(field(hpa.Object, "spec", "metrics", 0, "resource", "target", "averageUtilization")).To(BeEquivalentTo(70))
+		Expect(field(hpa.Object, "spec", "metrics", 1, "resource", "name")).To(Equal("memory"))
+		Expect(field(hpa.Object, "spec", "metrics", 2, "type")).To(Equal("Pods"))
+		Expect(field(hpa.Object, "spec", "metrics", 2, "pods", "target", "averageValue")).To(Equal("30"))
+
+		By("leaving the behavior to the server unless configured")
+		Expect(hpa.Object["spec"]).ToNot(HaveKey("behavior"))
+	})
+
+	It("targets object and external metrics", func() {
+		hpa := built(autoscale().
+			ObjectMetric("extensions/v1beta1", "Ingress", "web", "requests_per_second", "2k").
+			ExternalMetric("queue_messages", map[string]string{"queue": "jobs"}, "100").
+			ExternalAverageMetric("queue_messages", nil, "10").
+			AsKube())
+
+		Expect(field(hpa.Object, "spec", "metrics")).To(HaveLen(3))
+		Expect(field(hpa.Object, "spec", "metrics", 0, "object", "describedObject")).To(Equal(map[string]interface{}{
+			"apiVersion": "extensions/v1beta1", "kind": "Ingress", "name": "web",
+		}))
+		Expect(field(hpa.Object, "spec", "metrics", 0, "object", "target", "value")).To(Equal("2k"))
+		Expect(field(hpa.Object, "spec", "metrics", 1, "type")).To(Equal("External"))
+		Expect(field(hpa.Object, "spec", "metrics", 1, "external", "metric", "selector", "matchLabels", "queue")).To(Equal("jobs"))
+		Expect(field(hpa.Object, "spec", "metrics", 2, "external", "target", "averageValue")).To(Equal("10"))
+	})
+
+	It("configures scaling behavior", func() {
+		hpa := built(autoscale().ScaleDown(func(rules ScalingRulesBuilder) ScalingRulesBuilder {
+			return rules.Stabilization(600).Pods(1, 60).Percent(10, 60).SelectMin()
+		}).AsKube())
+
+		Expect(field(hpa.Object, "spec", "behavior", "scaleDown")).To(Equal(map[string]interface{}{
+			"stabilizationWindowSeconds": int64(600),
+			"selectPolicy":               "Min",
+			"policies": []interface{}{
+				map[string]interface{}{"type": "Pods", "value": int64(1), "periodSeconds": int64(60)},
+				map[string]interface{}{"type": "Percent", "value": int64(10), "periodSeconds": int64(60)},
+			},
+		}))
+
+		By("spelling out the defaults of the other direction")
+		Expect(field(hpa.Object, "spec", "behavior", "scaleUp", "stabilizationWindowSeconds")).To(BeEquivalentTo(0))
+		Expect(field(hpa.Object, "spec", "behavior", "scaleUp", "policies")).To(HaveLen(2))
+	})
+
+	It("reports metric targets which aren't quantities", func() {
+		hpa := autoscale().PodsMetric("queue_length", "lots")
+		_, err := hpa.AsKube()
+		Expect(err).To(MatchError(ContainSubstring(`invalid target value "lots"`)))
+		_, _, err = hpa.Push()
+		Expect(err).To(MatchError(ContainSubstring("metric pods/queue_length")))
+
+		By("accepting a valid target for the same metric")
+		_, err = hpa.PodsMetric("queue_length", "30").AsKube()
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("needs a dynamic client to push", func() {
+		_, _, err := autoscale().CPUUtilization(70).Push()
+		Expect(err).To(MatchError(ContainSubstring("no dynamic client")))
+	})
+
+	It("leaves the replicas of an autoscaled deployment alone", func() {
+		created, _, err := autoscale().Deployment().Push()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(*created.Spec.Replicas).To(BeEquivalentTo(2))
+
+		By("letting the autoscaler scale it")
+		scaleLive(7)
+
+		_, _, err = autoscale().Deployment().Replicas(3).Label("version", "2").Push()
+		Expect(err).ToNot(HaveOccurred())
+		live, err := fakeKubernetes.ExtensionsV1beta1().Deployments(namespace).Get(name, meta_v1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(*live.Spec.Replicas).To(BeEquivalentTo(7))
+		Expect(live.Labels).To(HaveKeyWithValue("version", "2"))
+	})
+
+	It("leaves the replicas alone whenever an autoscaler targets the deployment", func() {
+		_, _, err := deploy().Replicas(2).Push()
+		Expect(err).ToNot(HaveOccurred())
+
+		hpa := &autoscaling_v1.HorizontalPodAutoscaler{}
+		hpa.Name = name
+		hpa.Namespace = namespace
+		hpa.Spec.ScaleTargetRef = autoscaling_v1.CrossVersionObjectReference{Kind: "Deployment", Name: name}
+		hpa.Spec.MaxReplicas = 10
+		_, err = fakeKubernetes.AutoscalingV1().HorizontalPodAutoscalers(namespace).Create(hpa)
+		Expect(err).ToNot(HaveOccurred())
+		scaleLive(7)
+
+		diff, err := deploy().Replicas(2).Diff()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(diff.Changed()).To(BeFalse())
+
+		_, result, err := deploy().Replicas(2).Push()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Operation).To(Equal(OperationUnchanged))
+
+		_, err = PushDeployment(deploy().Replicas(2).AsKube(), fakeKubernetes)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(liveReplicas()).To(BeEquivalentTo(7))
+	})
+
+	It("pushes deployments for callers which may not list autoscalers", func() {
+		_, _, err := deploy().Replicas(2).Push()
+		Expect(err).ToNot(HaveOccurred())
+
+		fakeKubernetes.(*fake.Clientset).PrependReactor("list", "horizontalpodautoscalers", func(core.Action) (bool, runtime.Object, error) {
+			return true, nil, kube_errors.NewForbidden(schema.GroupResource{Group: "autoscaling", Resource: "horizontalpodautoscalers"}, "", errors.New("no access"))
+		})
+		_, err = PushDeployment(deploy().Replicas(3).AsKube(), fakeKubernetes)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(liveReplicas()).To(BeEquivalentTo(3))
+	})
+})
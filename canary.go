@@ -0,0 +1,163 @@
+package kube_builders
+
+import (
+	"math"
+
+	"github.com/pkg/errors"
+	kube_errors "k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/pkg/apis/extensions/v1beta1"
+)
+
+const (
+	canarySuffix = "-canary"
+	trackLabel   = "track"
+	canaryTrack  = "canary"
+)
+
+// CanaryBuilder releases a new version of a deployment to part of its traffic first. The new version
+// runs as a second deployment, suffixed -canary, whose pods carry the labels the stable service selects
+// by plus track=canary. A plain service balances over pods, so the weight is the share of the replicas
+// which run the canary, and the stable deployment is scaled down to make room. An autoscaled stable
+// deployment is left at the replicas its autoscaler picks instead.
+type CanaryBuilder struct {
+	deployment DeploymentBuilder
+	weight     int
+}
+
+// Canary starts a canary of the deployment taking weight percent of its traffic. The deployment is the
+// new version, with the name and replicas of the stable deployment it replaces.
+func (deployment DeploymentBuilder) Canary(weight int) CanaryBuilder {
+	return CanaryBuilder{deployment: deployment}.Weight(weight)
+}
+
+// Weight changes the percentage of traffic the canary takes, between 0 and 100. A canary can't take all of
+// the traffic, so pushing one at 100 fails; Promote it instead.
+func (canary CanaryBuilder) Weight(weight int) CanaryBuilder {
+	canary.weight = int(math.Max(0, math.Min(100, float64(weight))))
+	return canary
+}
+
+// Step raises the weight of the canary by increment, for pushing the next stage of a release.
+func (canary CanaryBuilder) Step(increment int) CanaryBuilder {
+	return canary.Weight(canary.weight + increment)
+}
+
+// Replicas returns how many replicas the stable and canary deployments run at the current weight. The
+// canary always gets at least one replica while its weight isn't 0, and the stable deployment always
+// keeps one, so with few replicas the canary runs on top of them and takes more than its weight.
+func (canary CanaryBuilder) Replicas() (stable, canaryReplicas int) {
+	total := canary.total()
+	canaryReplicas = int(math.Ceil(float64(total*canary.weight) / 100))
+	stable = total - canaryReplicas
+	if stable < 1 {
+		stable = 1
+	}
+	return
+}
+
+func (canary CanaryBuilder) total() int {
+	if canary.deployment.replicas > 0 {
+		return canary.deployment.replicas
+	}
+	return 1
+}
+
+// Canary returns the deployment running the new version next to the stable one.
+func (canary CanaryBuilder) Canary() DeploymentBuilder {
+	_, replicas := canary.Replicas()
+	stable := canary.deployment
+	podLabels := templateLabels(stable.name, stable.selector, stable.pod.Labels)
+
+	deployment := stable
+	deployment.name = stable.name + canarySuffix
+	deployment.replicas = replicas
+	deployment.exactReplicas = true
+	deployment.autoscaled = false
+	deployment.pod.Labels = copyMap(podLabels)
+	setAtMap(&deployment.pod.Labels, trackLabel, canaryTrack)
+	deployment.selector = copyMap(selectorFor(stable.selector, podLabels).MatchLabels)
+	setAtMap(&deployment.selector, trackLabel, canaryTrack)
+	deployment.labels = copyMap(stable.labels)
+	setAtMap(&deployment.labels, trackLabel, canaryTrack)
+	return deployment
+}
+
+// Push creates or updates the canary deployment, then scales the stable deployment down to its share.
+// The stable deployment is left untouched otherwise, so it keeps running the old version. It has to exist
+// already, as a canary without it would take all of the traffic.
+func (canary CanaryBuilder) Push() (kubeDeployment *v1beta1.Deployment, result PushResult, err error) {
+	stable := canary.deployment
+	if canary.weight == 100 {
+		err = errors.Errorf("canary of deployment %s can't take all of the traffic, promote it instead", stable.name)
+		return
+	}
+	if _, err = deploymentClient(stable.namespace, stable.kube.iface).get(stable.name); err != nil {
+		if kube_errors.IsNotFound(err) {
+			err = errors.Errorf("stable deployment %s doesn't exist, push it before its canary", stable.name)
+		} else {
+			err = errors.Wrapf(err, "failed to get stable deployment %s", stable.name)
+		}
+		return
+	}
+	kubeDeployment, result, err = canary.Canary().Push()
+	if err != nil {
+		return
+	}
+	stableReplicas, _ := canary.Replicas()
+	err = canary.scaleStable(stableReplicas)
+	return
+}
+
+// Promote rolls the new version out to the stable deployment at its full replicas, then deletes the
+// canary.
+func (canary CanaryBuilder) Promote() (kubeDeployment *v1beta1.Deployment, result PushResult, err error) {
+	kubeDeployment, result, err = canary.deployment.Replicas(canary.total()).Push()
+	if err != nil {
+		return
+	}
+	err = canary.deleteCanary()
+	return
+}
+
+// Abort scales the stable deployment back up and deletes the canary.
+func (canary CanaryBuilder) Abort() (err error) {
+	if err = canary.scaleStable(canary.total()); err != nil {
+		return
+	}
+	return canary.deleteCanary()
+}
+
+// scaleStable sets the replicas of the stable deployment, unless an autoscaler owns them.
+func (canary CanaryBuilder) scaleStable(replicas int) (err error) {
+	stable := canary.deployment
+	if stable.autoscaled {
+		return
+	}
+	autoscaled, err := deploymentAutoscaled(stable.kube.iface, stable.namespace, stable.name)
+	if err != nil || autoscaled {
+		return
+	}
+	scaled := int32(replicas)
+	return deploymentClient(stable.namespace, stable.kube.iface).modify(stable.name, stable.kube.dryRun, func(obj runtime.Object) error {
+		obj.(*v1beta1.Deployment).Spec.Replicas = &scaled
+		return nil
+	})
+}
+
+func (canary CanaryBuilder) deleteCanary() (err error) {
+	stable := canary.deployment
+	if stable.kube.IsDryRun() {
+		return
+	}
+	name := stable.name + canarySuffix
+	propagation := meta_v1.DeletePropagationBackground
+	err = stable.kube.iface.ExtensionsV1beta1().Deployments(stable.namespace).Delete(name, &meta_v1.DeleteOptions{PropagationPolicy: &propagation})
+	if kube_errors.IsNotFound(err) {
+		err = nil
+	} else if err != nil {
+		err = errors.Wrapf(err, "failed to delete canary deployment %s", name)
+	}
+	return
+}
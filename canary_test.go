@@ -0,0 +1,172 @@
+package kube_builders_test
+
+import (
+	. "github.com/Twister915/kube_builders"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	autoscaling_v1 "k8s.io/client-go/pkg/apis/autoscaling/v1"
+	"k8s.io/client-go/pkg/apis/extensions/v1beta1"
+)
+
+var _ = Describe("Canary", func() {
+	const (
+		namespace = "test"
+		name      = "web"
+	)
+
+	var (
+		fakeKubernetes kubernetes.Interface
+		kubeTarget     *KubeTarget
+	)
+
+	version := func(image string) DeploymentBuilder {
+		return kubeTarget.NewPod("", namespace).Label("app", name).Container("web", image, func(ctr ContainerBuilder) ContainerBuilder {
+			return ctr
+		}).Deployment(name).Replicas(4)
+	}
+
+	get := func(deploymentName string) (*v1beta1.Deployment, error) {
+		return fakeKubernetes.ExtensionsV1beta1().Deployments(namespace).Get(deploymentName, meta_v1.GetOptions{})
+	}
+
+	replicas := func(deploymentName string) int32 {
+		deployment, err := get(deploymentName)
+		Expect(err).ToNot(HaveOccurred())
+		return *deployment.Spec.Replicas
+	}
+
+	BeforeEach(func() {
+		fakeKubernetes = fake.NewSimpleClientset()
+		kubeTarget = NewKubeTarget(fakeKubernetes)
+
+		_, _, err := version("web:1").Push()
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("runs the new version next to the stable one", func() {
+		canary := version("web:2").Canary(25)
+		deployment, _, err := canary.Push()
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(deployment.Name).To(Equal("web-canary"))
+		Expect(deployment.Spec.Template.Labels).To(Equal(map[string]string{"app": name, "track": "canary"}))
+		Expect(deployment.Spec.Selector.MatchLabels).To(Equal(map[string]string{"app": name, "track": "canary"}))
+		Expect(*deployment.Spec.Replicas).To(BeEquivalentTo(1))
+		Expect(replicas(name)).To(BeEquivalentTo(3))
+
+		By("being selected by the stable service")
+		selector := version("web:2").Service(name).AsKube().Spec.Selector
+		Expect(selector).To(Equal(map[string]string{"app": name}))
+
+		By("stepping the weight up")
+		_, _, err = canary.Step(25).Push()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(replicas("web-canary")).To(BeEquivalentTo(2))
+		Expect(replicas(name)).To(BeEquivalentTo(2))
+	})
+
+	It("runs a canary at weight 0 without pods", func() {
+		deployment, _, err := version("web:2").Canary(0).Push()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(deployment.Spec.Replicas).ToNot(BeNil())
+		Expect(*deployment.Spec.Replicas).To(BeZero())
+		Expect(replicas(name)).To(BeEquivalentTo(4))
+	})
+
+	It("refuses to give a canary all of the traffic", func() {
+		_, _, err := version("web:2").Canary(100).Push()
+		Expect(err).To(MatchError(ContainSubstring("promote it instead")))
+		_, err = get("web-canary")
+		Expect(err).To(HaveOccurred())
+		Expect(replicas(name)).To(BeEquivalentTo(4))
+	})
+
+	It("keeps a stable deployment with a single replica running", func() {
+		_, _, err := version("web:1").Replicas(1).Push()
+		Expect(err).ToNot(HaveOccurred())
+
+		canary := version("web:2").Replicas(1).Canary(10)
+		stable, canaryReplicas := canary.Replicas()
+		Expect(stable).To(Equal(1))
+		Expect(canaryReplicas).To(Equal(1))
+
+		_, _, err = canary.Push()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(replicas(name)).To(BeEquivalentTo(1))
+		Expect(replicas("web-canary")).To(BeEquivalentTo(1))
+	})
+
+	It("needs the stable deployment to exist", func() {
+		missing := kubeTarget.NewPod("", namespace).Label("app", "api").Container("api", "api:2", func(ctr ContainerBuilder) ContainerBuilder {
+			return ctr
+		}).Deployment("api").Replicas(4)
+		_, _, err := missing.Canary(25).Push()
+		Expect(err).To(MatchError("stable deployment api doesn't exist, push it before its canary"))
+		_, err = get("api-canary")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("labels the canary from an explicit selector", func() {
+		api := func(image string) DeploymentBuilder {
+			return kubeTarget.NewPod("", namespace).Container("api", image, func(ctr ContainerBuilder) ContainerBuilder {
+				return ctr
+			}).Deployment("api").Selector("app", "api").Replicas(2)
+		}
+		_, _, err := api("api:1").Push()
+		Expect(err).ToNot(HaveOccurred())
+
+		deployment, _, err := api("api:2").Canary(50).Push()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(deployment.Spec.Template.Labels).To(Equal(map[string]string{"app": "api", "track": "canary"}))
+		Expect(deployment.Spec.Selector.MatchLabels).To(Equal(map[string]string{"app": "api", "track": "canary"}))
+	})
+
+	It("leaves the replicas of an autoscaled stable deployment alone", func() {
+		hpa := &autoscaling_v1.HorizontalPodAutoscaler{}
+		hpa.Name = name
+		hpa.Namespace = namespace
+		hpa.Spec.ScaleTargetRef = autoscaling_v1.CrossVersionObjectReference{Kind: "Deployment", Name: name}
+		hpa.Spec.MaxReplicas = 10
+		_, err := fakeKubernetes.AutoscalingV1().HorizontalPodAutoscalers(namespace).Create(hpa)
+		Expect(err).ToNot(HaveOccurred())
+
+		canary := version("web:2").Canary(25)
+		_, _, err = canary.Push()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(replicas(name)).To(BeEquivalentTo(4))
+
+		Expect(canary.Abort()).To(Succeed())
+		Expect(replicas(name)).To(BeEquivalentTo(4))
+	})
+
+	It("promotes the canary", func() {
+		canary := version("web:2").Canary(50)
+		_, _, err := canary.Push()
+		Expect(err).ToNot(HaveOccurred())
+
+		stable, _, err := canary.Promote()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(stable.Spec.Template.Spec.Containers[0].Image).To(Equal("web:2"))
+		Expect(*stable.Spec.Replicas).To(BeEquivalentTo(4))
+		_, err = get("web-canary")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("aborts the canary", func() {
+		canary := version("web:2").Canary(50)
+		_, _, err := canary.Push()
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(canary.Abort()).To(Succeed())
+		Expect(replicas(name)).To(BeEquivalentTo(4))
+		stable, err := get(name)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(stable.Spec.Template.Spec.Containers[0].Image).To(Equal("web:1"))
+		_, err = get("web-canary")
+		Expect(err).To(HaveOccurred())
+	})
+})
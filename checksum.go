@@ -0,0 +1,122 @@
+package kube_builders
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/pkg/errors"
+	kube_errors "k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+// not a provenance annotation, a changed checksum has to roll the pods
+const configChecksumAnnotation = "checksum/config"
+
+// stampConfigChecksum annotates a pod template with a hash of the content of every secret and config map
+// it references, so that changing one of them changes the template and rolls its pods.
+func stampConfigChecksum(template *v1.PodTemplateSpec, namespace string, iface kubernetes.Interface) (err error) {
+	secrets, configMaps := configReferences(template.Spec)
+
+	hash := sha256.New()
+	for _, name := range secrets {
+		var secret *v1.Secret
+		secret, err = iface.CoreV1().Secrets(namespace).Get(name, meta_v1.GetOptions{})
+		if kube_errors.IsNotFound(err) {
+			fmt.Fprintf(hash, "secret %s missing\n", name)
+			continue
+		} else if err != nil {
+			return errors.Wrapf(err, "failed to get secret %s for config checksum", name)
+		}
+		fmt.Fprintf(hash, "secret %s\n", name)
+		for _, key := range sortedKeys(secret.Data) {
+			fmt.Fprintf(hash, "%s=%x\n", key, secret.Data[key])
+		}
+	}
+	for _, name := range configMaps {
+		var configMap *v1.ConfigMap
+		configMap, err = iface.CoreV1().ConfigMaps(namespace).Get(name, meta_v1.GetOptions{})
+		if kube_errors.IsNotFound(err) {
+			fmt.Fprintf(hash, "config map %s missing\n", name)
+			continue
+		} else if err != nil {
+			return errors.Wrapf(err, "failed to get config map %s for config checksum", name)
+		}
+		fmt.Fprintf(hash, "config map %s\n", name)
+		writeStringMap(hash, configMap.Data)
+	}
+	err = nil
+
+	template.Annotations = copyMap(template.Annotations)
+	setAtMap(&template.Annotations, configChecksumAnnotation, fmt.Sprintf("%x", hash.Sum(nil)))
+	return
+}
+
+// configReferences lists the names of the secrets and config maps used by a pod, sorted and without
+// duplicates.
+func configReferences(spec v1.PodSpec) (secrets, configMaps []string) {
+	secretSet, configMapSet := make(map[string]bool), make(map[string]bool)
+
+	containers := append(append([]v1.Container(nil), spec.InitContainers...), spec.Containers...)
+	for _, container := range containers {
+		for _, env := range container.Env {
+			if env.ValueFrom == nil {
+				continue
+			}
+			if ref := env.ValueFrom.SecretKeyRef; ref != nil {
+				secretSet[ref.Name] = true
+			}
+			if ref := env.ValueFrom.ConfigMapKeyRef; ref != nil {
+				configMapSet[ref.Name] = true
+			}
+		}
+		for _, envFrom := range container.EnvFrom {
+			if envFrom.SecretRef != nil {
+				secretSet[envFrom.SecretRef.Name] = true
+			}
+			if envFrom.ConfigMapRef != nil {
+				configMapSet[envFrom.ConfigMapRef.Name] = true
+			}
+		}
+	}
+	for _, volume := range spec.Volumes {
+		if volume.Secret != nil {
+			secretSet[volume.Secret.SecretName] = true
+		}
+		if volume.ConfigMap != nil {
+			configMapSet[volume.ConfigMap.Name] = true
+		}
+	}
+
+	for name := range secretSet {
+		secrets = append(secrets, name)
+	}
+	for name := range configMapSet {
+		configMaps = append(configMaps, name)
+	}
+	sort.Strings(secrets)
+	sort.Strings(configMaps)
+	return
+}
+
+func sortedKeys(data map[string][]byte) (keys []string) {
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return
+}
+
+func writeStringMap(w io.Writer, data map[string]string) {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s=%q\n", key, data[key])
+	}
+}
@@ -0,0 +1,90 @@
+package kube_builders_test
+
+import (
+	"bytes"
+
+	. "github.com/Twister915/kube_builders"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var _ = Describe("Config Checksum", func() {
+	const (
+		namespace  = "test"
+		name       = "test"
+		secretName = "credentials"
+		annotation = "checksum/config"
+	)
+
+	var (
+		fakeKubernetes kubernetes.Interface
+		kubeTarget     *KubeTarget
+	)
+
+	deploy := func() DeploymentBuilder {
+		return kubeTarget.NewPod("", namespace).Container("web", "image", func(ctr ContainerBuilder) ContainerBuilder {
+			return ctr.Secret("PASSWORD", secretName, "password")
+		}).Deployment(name).ConfigChecksum()
+	}
+
+	pushSecret := func(password string) {
+		secret := kubeTarget.NewSecret(secretName, namespace).Value("password", password).AsKube()
+		secret.Data = map[string][]byte{"password": []byte(password)}
+		secret.StringData = nil
+		_, err := PushSecret(secret, fakeKubernetes)
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	BeforeEach(func() {
+		fakeKubernetes = fake.NewSimpleClientset()
+		kubeTarget = NewKubeTarget(fakeKubernetes)
+	})
+
+	It("rolls pods when a referenced secret changes", func() {
+		pushSecret("hunter2")
+		first, _, err := deploy().Push()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(first.Spec.Template.Annotations).To(HaveKey(annotation))
+
+		By("keeping the checksum while the secret is unchanged")
+		_, result, err := deploy().Push()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Operation).To(Equal(OperationUnchanged))
+
+		By("changing the checksum with the secret")
+		pushSecret("correct horse battery staple")
+		second, result, err := deploy().Push()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Operation).To(Equal(OperationUpdated))
+		Expect(second.Spec.Template.Annotations[annotation]).ToNot(Equal(first.Spec.Template.Annotations[annotation]))
+	})
+
+	It("does not add the checksum unless asked to", func() {
+		pushSecret("hunter2")
+		deployment, _, err := kubeTarget.NewPod("", namespace).Container("web", "image", func(ctr ContainerBuilder) ContainerBuilder {
+			return ctr.Secret("PASSWORD", secretName, "password")
+		}).Deployment(name).Push()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(deployment.Spec.Template.Annotations).ToNot(HaveKey(annotation))
+	})
+
+	It("adds the checksum wherever the deployment is built", func() {
+		pushSecret("hunter2")
+		pushed, _, err := deploy().Push()
+		Expect(err).ToNot(HaveOccurred())
+		checksum := pushed.Spec.Template.Annotations[annotation]
+
+		Expect(deploy().AsKube().Spec.Template.Annotations).To(HaveKeyWithValue(annotation, checksum))
+
+		var rendered bytes.Buffer
+		Expect(deploy().Render(&rendered, FormatYAML)).To(Succeed())
+		Expect(rendered.String()).To(ContainSubstring(checksum))
+
+		diff, err := deploy().Diff()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(diff.Changed()).To(BeFalse())
+	})
+})
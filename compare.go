@@ -0,0 +1,220 @@
+package kube_builders
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+// fields populated by the server which a builder never owns
+var serverMetadataFields = []string{
+	"uid", "resourceVersion", "generation", "creationTimestamp", "deletionTimestamp",
+	"deletionGracePeriodSeconds", "selfLink", "managedFields",
+}
+
+// FieldDiff is a single field that differs between the live object and the desired one. Path uses
+// dotted JSON field names with list indexes, for example spec.template.spec.containers[0].image.
+// A nil Live means the field is not set on the live object, and a nil Desired means pushing removes it.
+type FieldDiff struct {
+	Path    string
+	Live    interface{}
+	Desired interface{}
+}
+
+func (diff FieldDiff) String() string {
+	return fmt.Sprintf("%s: %v -> %v", diff.Path, diff.Live, diff.Desired)
+}
+
+// ownedFieldsEqual reports whether live and desired agree on every field a builder owns: labels,
+// annotations and everything outside metadata and status, such as spec and data. Those fields are
+// compared in full both ways, so a label or key removed from desired is a difference too. Both objects
+// get the defaults the API server applies and drop empty values first, and maps are compared by key so
+// their ordering never matters.
+func ownedFieldsEqual(live, desired runtime.Object) (equal bool, err error) {
+	diffs, err := diffOwnedFields(live, desired)
+	equal = err == nil && len(diffs) == 0
+	return
+}
+
+func diffOwnedFields(live, desired runtime.Object) (diffs []FieldDiff, err error) {
+	liveFields, err := compareFields(live)
+	if err != nil {
+		return
+	}
+	desiredFields, err := compareFields(desired)
+	if err != nil {
+		return
+	}
+	diffs = diffFields("", desiredFields, liveFields, diffs)
+	sortFieldDiffs(diffs)
+	return
+}
+
+func sortFieldDiffs(diffs []FieldDiff) {
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i].Path < diffs[j].Path })
+}
+
+func toFields(obj runtime.Object) (fields map[string]interface{}, err error) {
+	data, err := json.Marshal(normalize(obj))
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(data, &fields)
+	if err != nil {
+		return
+	}
+
+	delete(fields, "status")
+	if metadata, ok := fields["metadata"].(map[string]interface{}); ok {
+		for _, field := range serverMetadataFields {
+			delete(metadata, field)
+		}
+	}
+	return
+}
+
+// compareFields returns the fields of obj a builder owns, as compared by ownedFieldsEqual. The push time
+// annotation, which changes on every push, is left out.
+func compareFields(obj runtime.Object) (fields map[string]interface{}, err error) {
+	defaulted, err := withServerDefaults(obj)
+	if err != nil {
+		return
+	}
+	all, err := toFields(defaulted)
+	if err != nil {
+		return
+	}
+
+	fields = make(map[string]interface{})
+	for key, value := range all {
+		switch key {
+		case "apiVersion", "kind", "metadata":
+		default:
+			fields[key] = value
+		}
+	}
+	owned := make(map[string]interface{})
+	if metadata, ok := all["metadata"].(map[string]interface{}); ok {
+		for _, key := range []string{"labels", "annotations"} {
+			if value, set := metadata[key]; set {
+				owned[key] = value
+			}
+		}
+	}
+	fields["metadata"] = owned
+
+	// the push time changes on every push, so it doesn't count as a change by itself
+	if annotations, ok := owned["annotations"].(map[string]interface{}); ok {
+		delete(annotations, pushedAtAnnotation)
+	}
+	fields, _ = compact(fields).(map[string]interface{})
+	return
+}
+
+// withServerDefaults returns a copy of obj with the defaults the API server fills in, so an object built
+// locally compares equal to the same object read back from the cluster. Objects the scheme doesn't know,
+// such as custom resources, are returned as they are.
+func withServerDefaults(obj runtime.Object) (defaulted runtime.Object, err error) {
+	if _, ok := obj.(*unstructured.Unstructured); ok {
+		return obj, nil
+	}
+	if defaulted, err = scheme.Scheme.Copy(obj); err != nil {
+		return
+	}
+	scheme.Scheme.Default(defaulted)
+	return
+}
+
+// compact drops nulls, empty maps and empty lists, which the server treats the same as a missing field.
+// List elements are kept in place so indexes still line up.
+func compact(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		compacted := make(map[string]interface{})
+		for key, field := range typed {
+			if field = compact(field); field != nil {
+				compacted[key] = field
+			}
+		}
+		if len(compacted) == 0 {
+			return nil
+		}
+		return compacted
+	case []interface{}:
+		if len(typed) == 0 {
+			return nil
+		}
+		compacted := make([]interface{}, len(typed))
+		for i, element := range typed {
+			compacted[i] = compact(element)
+		}
+		return compacted
+	default:
+		return value
+	}
+}
+
+// normalize rewrites write-only fields into the form the server stores them in.
+func normalize(obj runtime.Object) runtime.Object {
+	switch typed := obj.(type) {
+	case *v1.Secret:
+		if len(typed.StringData) == 0 {
+			return obj
+		}
+		secret := *typed
+		secret.Data = make(map[string][]byte)
+		for key, value := range typed.Data {
+			secret.Data[key] = value
+		}
+		for key, value := range typed.StringData {
+			secret.Data[key] = []byte(value)
+		}
+		secret.StringData = nil
+		return &secret
+	}
+	return obj
+}
+
+// diffFields walks desired and live together, reporting fields set on either side which don't match.
+func diffFields(path string, desired, live interface{}, diffs []FieldDiff) []FieldDiff {
+	desiredMap, desiredIsMap := desired.(map[string]interface{})
+	liveMap, liveIsMap := live.(map[string]interface{})
+	if desiredIsMap && liveIsMap {
+		for key, value := range desiredMap {
+			diffs = diffFields(joinPath(path, key), value, liveMap[key], diffs)
+		}
+		for key, value := range liveMap {
+			if _, set := desiredMap[key]; !set {
+				diffs = diffFields(joinPath(path, key), nil, value, diffs)
+			}
+		}
+		return diffs
+	}
+
+	desiredSlice, desiredIsSlice := desired.([]interface{})
+	liveSlice, liveIsSlice := live.([]interface{})
+	if desiredIsSlice && liveIsSlice && len(desiredSlice) == len(liveSlice) {
+		for i := range desiredSlice {
+			diffs = diffFields(fmt.Sprintf("%s[%d]", path, i), desiredSlice[i], liveSlice[i], diffs)
+		}
+		return diffs
+	}
+
+	if !reflect.DeepEqual(desired, live) {
+		diffs = append(diffs, FieldDiff{Path: path, Live: live, Desired: desired})
+	}
+	return diffs
+}
+
+func joinPath(path, key string) string {
+	if len(path) == 0 {
+		return key
+	}
+	return path + "." + key
+}
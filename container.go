@@ -1,14 +1,20 @@
 package kube_builders
 
-import "k8s.io/client-go/pkg/api/v1"
+import (
+	"fmt"
+	"regexp"
+	"sort"
+
+	"k8s.io/client-go/pkg/api/v1"
+)
 
 type ContainerBuilder struct {
 	name  string
 	image string
 
-	envString map[string]string
-	envRefs   map[string]*v1.EnvVarSource
-	ports     map[string]uint16
+	env    []v1.EnvVar
+	ports  []v1.ContainerPort
+	sorted bool
 
 	mountDocker bool
 }
@@ -23,7 +29,7 @@ func NewContainer(name, image string) ContainerBuilder {
 }
 
 func (container ContainerBuilder) Env(name string, value interface{}) ContainerBuilder {
-	setAtMap(&container.envString, name, value)
+	container.env = setEnv(container.env, v1.EnvVar{Name: name, Value: fmt.Sprintf("%v", value)})
 	return container
 }
 
@@ -32,7 +38,7 @@ func (container ContainerBuilder) Secret(name, secretName, secretKey string) Con
 	selector.Name = secretName
 	selector.Key = secretKey
 
-	setAtMapDirect(&container.envRefs, name, &v1.EnvVarSource{SecretKeyRef: &selector})
+	container.env = setEnv(container.env, v1.EnvVar{Name: name, ValueFrom: &v1.EnvVarSource{SecretKeyRef: &selector}})
 	return container
 }
 
@@ -40,7 +46,7 @@ func (container ContainerBuilder) FieldRef(name, path string) ContainerBuilder {
 	var selector v1.ObjectFieldSelector
 	selector.FieldPath = path
 
-	setAtMapDirect(&container.envRefs, name, &v1.EnvVarSource{FieldRef: &selector})
+	container.env = setEnv(container.env, v1.EnvVar{Name: name, ValueFrom: &v1.EnvVarSource{FieldRef: &selector}})
 	return container
 }
 
@@ -49,7 +55,7 @@ func (container ContainerBuilder) ConfigMapRef(name, configMapName, configMapKey
 	selector.Name = configMapName
 	selector.Key = configMapKey
 
-	setAtMapDirect(&container.envRefs, name, &v1.EnvVarSource{ConfigMapKeyRef: &selector})
+	container.env = setEnv(container.env, v1.EnvVar{Name: name, ValueFrom: &v1.EnvVarSource{ConfigMapKeyRef: &selector}})
 	return container
 }
 
@@ -57,7 +63,7 @@ func (container ContainerBuilder) ResourceRef(name, resource string) ContainerBu
 	var selector v1.ResourceFieldSelector
 	selector.Resource = resource
 
-	setAtMapDirect(&container.envRefs, name, &v1.EnvVarSource{ResourceFieldRef: &selector})
+	container.env = setEnv(container.env, v1.EnvVar{Name: name, ValueFrom: &v1.EnvVarSource{ResourceFieldRef: &selector}})
 	return container
 }
 
@@ -67,33 +73,64 @@ func (container ContainerBuilder) MountDocker(value bool) ContainerBuilder {
 }
 
 func (container ContainerBuilder) Port(num int, name string) ContainerBuilder {
-	setAtMapDirect(&container.ports, name, uint16(num))
+	port := v1.ContainerPort{ContainerPort: int32(num), Name: name}
+	ports := append([]v1.ContainerPort(nil), container.ports...)
+	for i := range ports {
+		if ports[i].Name == name {
+			ports[i] = port
+			container.ports = ports
+			return container
+		}
+	}
+	container.ports = append(ports, port)
 	return container
 }
 
-func (container ContainerBuilder) AsKube() (kubeContainer v1.Container) {
-	kubeContainer.Name = container.name
-	kubeContainer.Image = container.image
+// PortProtocol sets the protocol of the port added under name, which is TCP by default.
+func (container ContainerBuilder) PortProtocol(name string, protocol v1.Protocol) ContainerBuilder {
+	return container.updatePort(name, func(port *v1.ContainerPort) {
+		port.Protocol = protocol
+	})
+}
 
-	envTarget := &kubeContainer.Env
-	if container.envString != nil {
-		for name, value := range container.envString {
-			*envTarget = append(*envTarget, v1.EnvVar{Name: name, Value: value})
-		}
-	}
+// HostPort also exposes the port added under name on the node the pod runs on.
+func (container ContainerBuilder) HostPort(name string, hostPort int) ContainerBuilder {
+	return container.updatePort(name, func(port *v1.ContainerPort) {
+		port.HostPort = int32(hostPort)
+	})
+}
 
-	if container.envRefs != nil {
-		for name, value := range container.envRefs {
-			*envTarget = append(*envTarget, v1.EnvVar{Name: name, ValueFrom: value})
+// updatePort changes the port added under name, and panics when there is none.
+func (container ContainerBuilder) updatePort(name string, update func(*v1.ContainerPort)) ContainerBuilder {
+	ports := append([]v1.ContainerPort(nil), container.ports...)
+	for i := range ports {
+		if ports[i].Name == name {
+			update(&ports[i])
+			container.ports = ports
+			return container
 		}
 	}
+	panic(fmt.Sprintf("container %s has no port named %q", container.name, name))
+}
 
-	if container.ports != nil {
-		portsTarget := &kubeContainer.Ports
-		for name, port := range container.ports {
-			*portsTarget = append(*portsTarget, v1.ContainerPort{ContainerPort: int32(port), Name: name})
-		}
+// Sorted orders env vars and ports by name instead of the order they were added in. Env vars that
+// reference others through $(NAME) are still placed after the vars they reference.
+func (container ContainerBuilder) Sorted() ContainerBuilder {
+	container.sorted = true
+	return container
+}
+
+func (container ContainerBuilder) AsKube() (kubeContainer v1.Container) {
+	kubeContainer.Name = container.name
+	kubeContainer.Image = container.image
+
+	kubeContainer.Env = append([]v1.EnvVar(nil), container.env...)
+	kubeContainer.Ports = append([]v1.ContainerPort(nil), container.ports...)
+	if container.sorted {
+		sort.SliceStable(kubeContainer.Env, func(i, j int) bool { return kubeContainer.Env[i].Name < kubeContainer.Env[j].Name })
+		sort.SliceStable(kubeContainer.Ports, func(i, j int) bool { return kubeContainer.Ports[i].Name < kubeContainer.Ports[j].Name })
 	}
+	kubeContainer.Env = orderEnvDependencies(kubeContainer.Env)
 
 	if container.mountDocker {
 		kubeContainer.VolumeMounts = append(kubeContainer.VolumeMounts, v1.VolumeMount{
@@ -105,3 +142,58 @@ func (container ContainerBuilder) AsKube() (kubeContainer v1.Container) {
 
 	return
 }
+
+// setEnv returns a copy of env with envVar replacing the var of the same name, or added at the end. The
+// copy keeps builders derived from the same container from sharing their env vars.
+func setEnv(env []v1.EnvVar, envVar v1.EnvVar) []v1.EnvVar {
+	env = append([]v1.EnvVar(nil), env...)
+	for i := range env {
+		if env[i].Name == envVar.Name {
+			env[i] = envVar
+			return env
+		}
+	}
+	return append(env, envVar)
+}
+
+// matches $(NAME) references, and the $$ escape so that $$(NAME) is not treated as one
+var envReference = regexp.MustCompile(`\$\$|\$\(([^)]+)\)`)
+
+// orderEnvDependencies moves env vars after the vars they reference, as kubernetes only expands
+// references to vars defined earlier in the list. Otherwise the existing order is kept. Cycles can't be
+// resolved and are left in place.
+func orderEnvDependencies(env []v1.EnvVar) (ordered []v1.EnvVar) {
+	defined := make(map[string]bool)
+	for _, envVar := range env {
+		defined[envVar.Name] = true
+	}
+
+	placed := make(map[string]bool)
+	remaining := env
+	for len(remaining) > 0 {
+		var next []v1.EnvVar
+		picked := false
+		for _, envVar := range remaining {
+			ready := true
+			for _, match := range envReference.FindAllStringSubmatch(envVar.Value, -1) {
+				ref := match[1]
+				if len(ref) > 0 && ref != envVar.Name && defined[ref] && !placed[ref] {
+					ready = false
+					break
+				}
+			}
+			if ready && !picked {
+				ordered = append(ordered, envVar)
+				placed[envVar.Name] = true
+				picked = true
+			} else {
+				next = append(next, envVar)
+			}
+		}
+		if !picked {
+			return append(ordered, remaining...)
+		}
+		remaining = next
+	}
+	return
+}
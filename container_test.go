@@ -78,6 +78,52 @@ var _ = Describe("Container Builder", func() {
 		Expect(kubeContainer.Env).To(ContainElement(v1.EnvVar{Name: "TEST_RESOURCE", ValueFrom: &v1.EnvVarSource{ResourceFieldRef: &rscSelector}}))
 	})
 
+	It("keeps env vars and ports in the order they were added", func() {
+		kubeContainer := NewContainer(name, image).
+			Env("C", 3).Env("A", 1).Env("B", 2).
+			Port(8080, "web").Port(9090, "metrics").
+			AsKube()
+		Expect(kubeContainer.Env).To(Equal([]v1.EnvVar{{Name: "C", Value: "3"}, {Name: "A", Value: "1"}, {Name: "B", Value: "2"}}))
+		Expect(kubeContainer.Ports[0].Name).To(Equal("web"))
+		Expect(kubeContainer.Ports[1].Name).To(Equal("metrics"))
+
+		By("sorting when asked to")
+		kubeContainer = NewContainer(name, image).
+			Env("C", 3).Env("A", 1).Env("B", 2).
+			Port(8080, "web").Port(9090, "metrics").
+			Sorted().
+			AsKube()
+		Expect(kubeContainer.Env).To(Equal([]v1.EnvVar{{Name: "A", Value: "1"}, {Name: "B", Value: "2"}, {Name: "C", Value: "3"}}))
+		Expect(kubeContainer.Ports[0].Name).To(Equal("metrics"))
+	})
+
+	It("doesn't share env vars and ports between derived builders", func() {
+		base := NewContainer(name, image).Env("A", 1).Env("B", 2).Port(8080, "web").Port(9090, "metrics")
+		changed := base.Env("A", 10).Port(8081, "web")
+		added := base.Env("C", 3).Port(7070, "admin")
+		base.Env("D", 4).Port(6060, "debug")
+
+		Expect(base.AsKube().Env).To(Equal([]v1.EnvVar{{Name: "A", Value: "1"}, {Name: "B", Value: "2"}}))
+		Expect(base.AsKube().Ports[0].ContainerPort).To(BeEquivalentTo(8080))
+		Expect(changed.AsKube().Env[0].Value).To(Equal("10"))
+		Expect(added.AsKube().Env[2].Name).To(Equal("C"))
+		Expect(added.AsKube().Ports[2].Name).To(Equal("admin"))
+	})
+
+	It("places env vars after the vars they reference", func() {
+		kubeContainer := NewContainer(name, image).
+			Env("URL", "http://$(HOST):$(PORT)").
+			Env("LITERAL", "$$(HOST)").
+			Env("HOST", "localhost").
+			Env("PORT", 80).
+			AsKube()
+		var names []string
+		for _, env := range kubeContainer.Env {
+			names = append(names, env.Name)
+		}
+		Expect(names).To(Equal([]string{"LITERAL", "HOST", "PORT", "URL"}))
+	})
+
 	It("can set field env var", func() {
 		By("creating it in the builder")
 		container = container.FieldRef("TEST_FIELD", "field")
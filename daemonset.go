@@ -1,24 +1,36 @@
 package kube_builders
 
 import (
+	"io"
+
 	"github.com/pkg/errors"
-	"k8s.io/client-go/pkg/api/v1"
-	"k8s.io/client-go/pkg/apis/extensions/v1beta1"
-	kube_errors "k8s.io/apimachinery/pkg/api/errors"
 	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/pkg/apis/extensions/v1beta1"
 )
 
+// the API server counts template changes of a daemon set in this annotation
+const templateGenerationAnnotation = "deprecated.daemonset.template.generation"
+
 type DaemonSetBuilder struct {
 	kube *KubeTarget
 
 	name      string
 	namespace string
 
-	pod            v1.Pod
-	labels         map[string]string
-	annotations    map[string]string
-	rollingUpdates bool
+	pod             v1.Pod
+	labels          map[string]string
+	annotations     map[string]string
+	rollingUpdates  bool
+	maxUnavailable  *intstr.IntOrString
+	minReadySeconds int
+
+	selector                 map[string]string
+	recreateOnSelectorChange bool
+	configChecksum           bool
 }
 
 func (pod PodBuilder) DaemonSet(name string) DaemonSetBuilder {
@@ -35,50 +47,166 @@ func (ds DaemonSetBuilder) Annotation(annotation string, value interface{}) Daem
 	return ds
 }
 
+// Selector sets the label selector of the daemon set explicitly. By default every pod label is used.
+func (ds DaemonSetBuilder) Selector(label string, value interface{}) DaemonSetBuilder {
+	setAtMap(&ds.selector, label, value)
+	return ds
+}
+
+// RecreateOnSelectorChange makes Push delete and recreate the daemon set when its selector changed,
+// instead of failing. This causes downtime as all existing pods are removed first.
+func (ds DaemonSetBuilder) RecreateOnSelectorChange() DaemonSetBuilder {
+	ds.recreateOnSelectorChange = true
+	return ds
+}
+
+// ConfigChecksum annotates the pod template with a checksum of the secrets and config maps it
+// references, so pods are replaced whenever one of them changes. They are read from the cluster whenever
+// the daemon set is built.
+func (ds DaemonSetBuilder) ConfigChecksum() DaemonSetBuilder {
+	ds.configChecksum = true
+	return ds
+}
+
 func (ds DaemonSetBuilder) RollingUpdates() DaemonSetBuilder {
 	ds.rollingUpdates = true
 	return ds
 }
 
+// RollingUpdate enables rolling updates replacing at most maxUnavailable pods at a time, given as an int
+// or a percentage of the scheduled pods such as "10%". The extensions/v1beta1 API has no surge setting
+// for daemon sets, so old pods are always removed before their replacement starts.
+func (ds DaemonSetBuilder) RollingUpdate(maxUnavailable interface{}) DaemonSetBuilder {
+	unavailable := intOrPercent(maxUnavailable)
+	ds.rollingUpdates = true
+	ds.maxUnavailable = &unavailable
+	return ds
+}
+
+func (ds DaemonSetBuilder) MinReadySeconds(seconds int) DaemonSetBuilder {
+	ds.minReadySeconds = seconds
+	return ds
+}
+
+// Service returns a service selecting the pods of the daemon set, with a port for each named container
+// port. Ports and selector can still be changed on the returned builder.
+func (ds DaemonSetBuilder) Service(name string) ServiceBuilder {
+	kubeDs := ds.kubeObject()
+	return ds.kube.workloadService(name, ds.namespace, kubeDs.Spec.Selector, kubeDs.Spec.Template.Spec)
+}
+
+// AsKube builds the daemon set without checking it. The config checksum is left off when the config it
+// covers can't be read. Render, Diff and Push return these errors instead.
 func (ds DaemonSetBuilder) AsKube() (kubeDs *v1beta1.DaemonSet) {
+	kubeDs, _ = ds.build()
+	return
+}
+
+// build is the daemon set as AsKube, Render, Diff and Push produce it, with the config checksum. It fails
+// on a daemon set the server would reject or never schedule.
+func (ds DaemonSetBuilder) build() (kubeDs *v1beta1.DaemonSet, err error) {
+	kubeDs = ds.kubeObject()
+	if ds.configChecksum {
+		if err = stampConfigChecksum(&kubeDs.Spec.Template, kubeDs.Namespace, ds.kube.iface); err != nil {
+			return
+		}
+	}
+	if err = validateSelector(kubeDs.Spec.Selector, kubeDs.Spec.Template.Labels); err == nil {
+		err = validatePodPorts(kubeDs.Spec.Template.Spec)
+	}
+	if err != nil {
+		err = errors.Wrapf(err, "daemon set %s", ds.name)
+	}
+	return
+}
+
+// kubeObject is the daemon set without anything read from the cluster.
+func (ds DaemonSetBuilder) kubeObject() (kubeDs *v1beta1.DaemonSet) {
 	kubeDs = new(v1beta1.DaemonSet)
+	kubeDs.TypeMeta = meta_v1.TypeMeta{Kind: "DaemonSet", APIVersion: v1beta1.SchemeGroupVersion.String()}
 	kubeDs.Name = ds.name
 	kubeDs.Namespace = ds.namespace
 
+	podLabels := templateLabels(ds.name, ds.selector, ds.pod.Labels)
+	kubeDs.Spec.Selector = selectorFor(ds.selector, podLabels)
 	kubeDs.Spec.Template.Spec = ds.pod.Spec
 	kubeDs.Spec.Template.Annotations = ds.pod.Annotations
-	kubeDs.Spec.Template.Labels = ds.pod.Labels
+	kubeDs.Spec.Template.Labels = podLabels
 	if ds.rollingUpdates {
 		kubeDs.Spec.UpdateStrategy.Type = v1beta1.RollingUpdateDaemonSetStrategyType
+		if ds.maxUnavailable != nil {
+			kubeDs.Spec.UpdateStrategy.RollingUpdate = &v1beta1.RollingUpdateDaemonSet{MaxUnavailable: ds.maxUnavailable}
+		}
 	}
+	kubeDs.Spec.MinReadySeconds = int32(ds.minReadySeconds)
 
 	kubeDs.Labels = ds.labels
 	kubeDs.Annotations = ds.annotations
+	ds.kube.stampProvenance(&kubeDs.ObjectMeta)
+	ds.kube.stampTemplateProvenance(&kubeDs.Spec.Template.ObjectMeta)
 	return
 }
 
-func (ds DaemonSetBuilder) Push() (kubeDs *v1beta1.DaemonSet, err error) {
-	kubeDs = ds.AsKube()
-	err = PushDaemonSet(kubeDs, ds.kube.iface)
-	return
+func (ds DaemonSetBuilder) Render(w io.Writer, format Format) error {
+	kubeDs, err := ds.build()
+	if err != nil {
+		return err
+	}
+	return Render(w, format, kubeDs)
 }
 
-func PushDaemonSet(kubeDs *v1beta1.DaemonSet, iface kubernetes.Interface) (err error) {
-	dses := iface.ExtensionsV1beta1().DaemonSets(kubeDs.Namespace)
+func (ds DaemonSetBuilder) Diff() (ObjectDiff, error) {
+	kubeDs, err := ds.build()
+	if err != nil {
+		return ObjectDiff{}, err
+	}
+	return ds.kube.diff(kubeDs)
+}
 
-	_, err = dses.Get(kubeDs.Name, meta_v1.GetOptions{})
-	if kube_errors.IsNotFound(err) {
-		_, err = dses.Create(kubeDs)
-		if err != nil {
-			err = errors.Wrapf(err, "failed to create daemon set")
-		}
-	} else if err != nil {
-		err = errors.Wrapf(err, "failed to get current daemon set")
-	} else {
-		_, err = dses.Update(kubeDs)
-		if err != nil {
-			err = errors.Wrapf(err, "failed to update daemon set")
-		}
+func (ds DaemonSetBuilder) Push() (kubeDs *v1beta1.DaemonSet, result PushResult, err error) {
+	if kubeDs, err = ds.build(); err != nil {
+		return
+	}
+	client := daemonSetClient(kubeDs.Namespace, ds.kube.iface)
+	client.recreateImmutable = ds.recreateOnSelectorChange
+	result, err = client.push(kubeDs, ds.kube.dryRun)
+	if persisted, ok := result.Object.(*v1beta1.DaemonSet); ok {
+		kubeDs = persisted
 	}
 	return
 }
+
+func PushDaemonSet(kubeDs *v1beta1.DaemonSet, iface kubernetes.Interface) (result PushResult, err error) {
+	return daemonSetClient(kubeDs.Namespace, iface).push(kubeDs, dryRunNone)
+}
+
+func daemonSetClient(namespace string, iface kubernetes.Interface) objectClient {
+	dses := iface.ExtensionsV1beta1().DaemonSets(namespace)
+	return objectClient{
+		kind:      "daemon set",
+		resource:  "daemonsets",
+		namespace: namespace,
+		rest:      iface.ExtensionsV1beta1().RESTClient(),
+		newObject: func() runtime.Object { return new(v1beta1.DaemonSet) },
+		get: func(name string) (runtime.Object, error) {
+			return dses.Get(name, meta_v1.GetOptions{})
+		},
+		create: func(obj runtime.Object) (runtime.Object, error) {
+			return dses.Create(obj.(*v1beta1.DaemonSet))
+		},
+		update: func(obj runtime.Object) (runtime.Object, error) {
+			return dses.Update(obj.(*v1beta1.DaemonSet))
+		},
+		delete: dses.Delete,
+		immutable: selectorImmutable(func(obj runtime.Object) *meta_v1.LabelSelector {
+			return obj.(*v1beta1.DaemonSet).Spec.Selector
+		}),
+		prepare: func(live, desired runtime.Object) (runtime.Object, error) {
+			liveDs, next := live.(*v1beta1.DaemonSet), *desired.(*v1beta1.DaemonSet)
+			keepAnnotations(&liveDs.ObjectMeta, &next.ObjectMeta, templateGenerationAnnotation)
+			keepRestartedAt(&liveDs.Spec.Template.ObjectMeta, &next.Spec.Template.ObjectMeta)
+			keepPaused(liveDs, &next)
+			return &next, nil
+		},
+	}
+}
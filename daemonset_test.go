@@ -8,6 +8,7 @@ import (
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/fake"
 	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/pkg/apis/extensions/v1beta1"
 	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -57,9 +58,16 @@ var _ = Describe("Daemonset Builder", func() {
 		Expect(container.Ports).To(ContainElement(v1.ContainerPort{Name: containerPortName, ContainerPort: containerPort}))
 	})
 
+	It("configures rolling updates", func() {
+		ds := pod.DaemonSet(name).RollingUpdate("10%").MinReadySeconds(3).AsKube()
+		Expect(ds.Spec.UpdateStrategy.Type).To(Equal(v1beta1.RollingUpdateDaemonSetStrategyType))
+		Expect(ds.Spec.UpdateStrategy.RollingUpdate.MaxUnavailable.String()).To(Equal("10%"))
+		Expect(ds.Spec.MinReadySeconds).To(BeEquivalentTo(3))
+	})
+
 	It("pushes to kubernetes", func() {
 		By("pushing")
-		_, err := pod.DaemonSet(name).Push()
+		_, _, err := pod.DaemonSet(name).Push()
 		Expect(err).ToNot(HaveOccurred())
 
 		By("being on kubernetes")
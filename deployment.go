@@ -1,9 +1,11 @@
 package kube_builders
 
 import (
+	"io"
+
 	"github.com/pkg/errors"
-	kube_errors "k8s.io/apimachinery/pkg/api/errors"
 	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/pkg/api/v1"
 	"k8s.io/client-go/pkg/apis/extensions/v1beta1"
 	"k8s.io/client-go/kubernetes"
@@ -16,10 +18,26 @@ type DeploymentBuilder struct {
 	namespace string
 
 	replicas, history int
+	// set for canaries, whose replicas are pushed even when 0 instead of being left to the server
+	exactReplicas bool
+
+	strategy                v1beta1.DeploymentStrategy
+	minReadySeconds         int
+	progressDeadlineSeconds *int
+	paused                  *bool
 
 	pod         v1.Pod
 	labels      map[string]string
 	annotations map[string]string
+
+	selector                 map[string]string
+	recreateOnSelectorChange bool
+	rollbackOnFailure        bool
+	configChecksum           bool
+
+	// set by Autoscale, an autoscaled deployment is created with minReplicas and keeps its live replicas
+	autoscaled  bool
+	minReplicas int
 }
 
 func (pod PodBuilder) Deployment(name string) (deployment DeploymentBuilder) {
@@ -30,6 +48,8 @@ func (pod PodBuilder) Deployment(name string) (deployment DeploymentBuilder) {
 	return
 }
 
+// Replicas sets the number of pods. Once an autoscaler targets the deployment, it owns the replicas and
+// pushes leave them as they are.
 func (deployment DeploymentBuilder) Replicas(num int) DeploymentBuilder {
 	deployment.replicas = num
 	return deployment
@@ -50,16 +70,118 @@ func (deployment DeploymentBuilder) History(count int) DeploymentBuilder {
 	return deployment
 }
 
+// RollingUpdate replaces pods gradually. Both limits take an int or a percentage of the desired replicas
+// such as "25%".
+func (deployment DeploymentBuilder) RollingUpdate(maxSurge, maxUnavailable interface{}) DeploymentBuilder {
+	surge, unavailable := intOrPercent(maxSurge), intOrPercent(maxUnavailable)
+	deployment.strategy = v1beta1.DeploymentStrategy{
+		Type:          v1beta1.RollingUpdateDeploymentStrategyType,
+		RollingUpdate: &v1beta1.RollingUpdateDeployment{MaxSurge: &surge, MaxUnavailable: &unavailable},
+	}
+	return deployment
+}
+
+// Recreate kills all existing pods before new ones are created.
+func (deployment DeploymentBuilder) Recreate() DeploymentBuilder {
+	deployment.strategy = v1beta1.DeploymentStrategy{Type: v1beta1.RecreateDeploymentStrategyType}
+	return deployment
+}
+
+func (deployment DeploymentBuilder) MinReadySeconds(seconds int) DeploymentBuilder {
+	deployment.minReadySeconds = seconds
+	return deployment
+}
+
+func (deployment DeploymentBuilder) ProgressDeadlineSeconds(seconds int) DeploymentBuilder {
+	deployment.progressDeadlineSeconds = new(int)
+	*deployment.progressDeadlineSeconds = seconds
+	return deployment
+}
+
+// Paused pauses or resumes the rollout of the deployment on every push. Without it, pushes leave the
+// deployment paused or not, as KubeTarget.Pause and Resume set it.
+func (deployment DeploymentBuilder) Paused(paused bool) DeploymentBuilder {
+	deployment.paused = new(bool)
+	*deployment.paused = paused
+	return deployment
+}
+
+// RollbackOnFailure makes PushAndWait restore the deployment as it was before the push when the rollout
+// doesn't succeed. PushDeploymentAndWait does the same for deployments built elsewhere.
+func (deployment DeploymentBuilder) RollbackOnFailure() DeploymentBuilder {
+	deployment.rollbackOnFailure = true
+	return deployment
+}
+
+// ConfigChecksum annotates the pod template with a checksum of the secrets and config maps it
+// references, so pods are replaced whenever one of them changes. They are read from the cluster whenever
+// the deployment is built.
+func (deployment DeploymentBuilder) ConfigChecksum() DeploymentBuilder {
+	deployment.configChecksum = true
+	return deployment
+}
+
+// Selector sets the label selector of the deployment explicitly. By default every pod label is used.
+func (deployment DeploymentBuilder) Selector(label string, value interface{}) DeploymentBuilder {
+	setAtMap(&deployment.selector, label, value)
+	return deployment
+}
+
+// RecreateOnSelectorChange makes Push delete and recreate the deployment when its selector changed,
+// instead of failing. This causes downtime as all existing pods are removed first.
+func (deployment DeploymentBuilder) RecreateOnSelectorChange() DeploymentBuilder {
+	deployment.recreateOnSelectorChange = true
+	return deployment
+}
+
+// Service returns a service selecting the pods of the deployment, with a port for each named container
+// port. Ports and selector can still be changed on the returned builder.
+func (deployment DeploymentBuilder) Service(name string) ServiceBuilder {
+	kubeDeployment := deployment.kubeObject()
+	return deployment.kube.workloadService(name, deployment.namespace, kubeDeployment.Spec.Selector, kubeDeployment.Spec.Template.Spec)
+}
+
+// AsKube builds the deployment without checking it. The config checksum is left off when the config it
+// covers can't be read. Render, Diff and Push return these errors instead.
 func (deployment DeploymentBuilder) AsKube() (kubeDeployment *v1beta1.Deployment) {
+	kubeDeployment, _ = deployment.build()
+	return
+}
+
+// build is the deployment as AsKube, Render, Diff and Push produce it, with the config checksum. It fails
+// on a deployment the server would reject or never schedule.
+func (deployment DeploymentBuilder) build() (kubeDeployment *v1beta1.Deployment, err error) {
+	kubeDeployment = deployment.kubeObject()
+	if deployment.configChecksum {
+		if err = stampConfigChecksum(&kubeDeployment.Spec.Template, kubeDeployment.Namespace, deployment.kube.iface); err != nil {
+			return
+		}
+	}
+	if err = validateSelector(kubeDeployment.Spec.Selector, kubeDeployment.Spec.Template.Labels); err == nil {
+		err = validatePodPorts(kubeDeployment.Spec.Template.Spec)
+	}
+	if err != nil {
+		err = errors.Wrapf(err, "deployment %s", deployment.name)
+	}
+	return
+}
+
+// kubeObject is the deployment without anything read from the cluster.
+func (deployment DeploymentBuilder) kubeObject() (kubeDeployment *v1beta1.Deployment) {
 	kubeDeployment = new(v1beta1.Deployment)
+	kubeDeployment.TypeMeta = meta_v1.TypeMeta{Kind: "Deployment", APIVersion: v1beta1.SchemeGroupVersion.String()}
 	kubeDeployment.Name = deployment.name
 	kubeDeployment.Namespace = deployment.namespace
 	kubeDeployment.Annotations = deployment.annotations
 	kubeDeployment.Labels = deployment.labels
 
-	if deployment.replicas > 0 {
+	replicas := deployment.replicas
+	if deployment.autoscaled && replicas < deployment.minReplicas {
+		replicas = deployment.minReplicas
+	}
+	if replicas > 0 || deployment.exactReplicas {
 		kubeDeployment.Spec.Replicas = new(int32)
-		*kubeDeployment.Spec.Replicas = int32(deployment.replicas)
+		*kubeDeployment.Spec.Replicas = int32(replicas)
 	}
 
 	if deployment.history > 0 {
@@ -67,34 +189,131 @@ func (deployment DeploymentBuilder) AsKube() (kubeDeployment *v1beta1.Deployment
 		*kubeDeployment.Spec.RevisionHistoryLimit = int32(deployment.history)
 	}
 
+	kubeDeployment.Spec.Strategy = deployment.strategy
+	kubeDeployment.Spec.MinReadySeconds = int32(deployment.minReadySeconds)
+	if deployment.paused != nil {
+		kubeDeployment.Spec.Paused = *deployment.paused
+	}
+	if deployment.progressDeadlineSeconds != nil {
+		kubeDeployment.Spec.ProgressDeadlineSeconds = new(int32)
+		*kubeDeployment.Spec.ProgressDeadlineSeconds = int32(*deployment.progressDeadlineSeconds)
+	}
+
+	podLabels := templateLabels(deployment.name, deployment.selector, deployment.pod.Labels)
+	kubeDeployment.Spec.Selector = selectorFor(deployment.selector, podLabels)
 	kubeDeployment.Spec.Template.Spec = deployment.pod.Spec
-	kubeDeployment.Spec.Template.ObjectMeta.Labels = deployment.pod.Labels
+	kubeDeployment.Spec.Template.ObjectMeta.Labels = podLabels
 	kubeDeployment.Spec.Template.ObjectMeta.Annotations = deployment.pod.Annotations
+	deployment.kube.stampProvenance(&kubeDeployment.ObjectMeta)
+	deployment.kube.stampTemplateProvenance(&kubeDeployment.Spec.Template.ObjectMeta)
 	return
 }
 
-func (deployment DeploymentBuilder) Push() (kubeDeployment *v1beta1.Deployment, err error) {
-	kubeDeployment = deployment.AsKube()
-	err = PushDeployment(kubeDeployment, deployment.kube.iface)
-	return
+func (deployment DeploymentBuilder) Render(w io.Writer, format Format) error {
+	kubeDeployment, err := deployment.build()
+	if err != nil {
+		return err
+	}
+	return Render(w, format, kubeDeployment)
 }
 
-func PushDeployment(kubeDeployment *v1beta1.Deployment, iface kubernetes.Interface) (err error) {
-	deployments := iface.ExtensionsV1beta1().Deployments(kubeDeployment.Namespace)
+func (deployment DeploymentBuilder) Diff() (ObjectDiff, error) {
+	kubeDeployment, err := deployment.build()
+	if err != nil {
+		return ObjectDiff{}, err
+	}
+	return deployment.client().diff(kubeDeployment)
+}
+
+func (deployment DeploymentBuilder) Push() (kubeDeployment *v1beta1.Deployment, result PushResult, err error) {
+	if kubeDeployment, err = deployment.build(); err != nil {
+		return
+	}
+	result, err = deployment.client().push(kubeDeployment, deployment.kube.dryRun)
+	if persisted, ok := result.Object.(*v1beta1.Deployment); ok {
+		kubeDeployment = persisted
+	}
+	return
+}
 
-	_, err = deployments.Get(kubeDeployment.Name, meta_v1.GetOptions{})
-	if kube_errors.IsNotFound(err) {
-		_, err = deployments.Create(kubeDeployment)
-		if err != nil {
-			err = errors.Wrapf(err, "failed to create deployment")
+func (deployment DeploymentBuilder) client() objectClient {
+	client := deploymentClient(deployment.namespace, deployment.kube.iface)
+	client.recreateImmutable = deployment.recreateOnSelectorChange
+	if deployment.paused == nil {
+		// a deployment paused by KubeTarget.Pause stays paused until Resume
+		prepare := client.prepare
+		client.prepare = func(live, desired runtime.Object) (runtime.Object, error) {
+			next, err := prepare(live, desired)
+			if err != nil {
+				return nil, err
+			}
+			next.(*v1beta1.Deployment).Spec.Paused = live.(*v1beta1.Deployment).Spec.Paused
+			return next, nil
 		}
-	} else if err != nil {
-		err = errors.Wrapf(err, "failed to get current deployments")
-	} else {
-		_, err = deployments.Update(kubeDeployment)
-		if err != nil {
-			err = errors.Wrapf(err, "failed to update deployment")
+	}
+	if deployment.autoscaled {
+		// the autoscaler owns the replicas once the deployment exists, even before the autoscaler does
+		prepare := client.prepare
+		client.prepare = func(live, desired runtime.Object) (runtime.Object, error) {
+			next, err := prepare(live, desired)
+			if err != nil {
+				return nil, err
+			}
+			next.(*v1beta1.Deployment).Spec.Replicas = live.(*v1beta1.Deployment).Spec.Replicas
+			return next, nil
 		}
 	}
-	return
-}
\ No newline at end of file
+	return client
+}
+
+func PushDeployment(kubeDeployment *v1beta1.Deployment, iface kubernetes.Interface) (result PushResult, err error) {
+	return deploymentClient(kubeDeployment.Namespace, iface).push(kubeDeployment, dryRunNone)
+}
+
+func deploymentClient(namespace string, iface kubernetes.Interface) objectClient {
+	deployments := iface.ExtensionsV1beta1().Deployments(namespace)
+	return objectClient{
+		kind:      "deployment",
+		resource:  "deployments",
+		namespace: namespace,
+		rest:      iface.ExtensionsV1beta1().RESTClient(),
+		newObject: func() runtime.Object { return new(v1beta1.Deployment) },
+		get: func(name string) (runtime.Object, error) {
+			return deployments.Get(name, meta_v1.GetOptions{})
+		},
+		create: func(obj runtime.Object) (runtime.Object, error) {
+			return deployments.Create(obj.(*v1beta1.Deployment))
+		},
+		update: func(obj runtime.Object) (runtime.Object, error) {
+			return deployments.Update(obj.(*v1beta1.Deployment))
+		},
+		delete: deployments.Delete,
+		immutable: selectorImmutable(func(obj runtime.Object) *meta_v1.LabelSelector {
+			return obj.(*v1beta1.Deployment).Spec.Selector
+		}),
+		prepare: func(live, desired runtime.Object) (runtime.Object, error) {
+			liveDeployment, next := live.(*v1beta1.Deployment), *desired.(*v1beta1.Deployment)
+			// the deployment controller numbers revisions on the deployment itself
+			keepAnnotations(&liveDeployment.ObjectMeta, &next.ObjectMeta, revisionAnnotation)
+			keepRestartedAt(&liveDeployment.Spec.Template.ObjectMeta, &next.Spec.Template.ObjectMeta)
+			// servers default these differently depending on their version, extensions/v1beta1 ones to
+			// MaxInt32, so fields left unset are taken as they are live
+			if next.Spec.RevisionHistoryLimit == nil {
+				next.Spec.RevisionHistoryLimit = liveDeployment.Spec.RevisionHistoryLimit
+			}
+			if next.Spec.ProgressDeadlineSeconds == nil {
+				next.Spec.ProgressDeadlineSeconds = liveDeployment.Spec.ProgressDeadlineSeconds
+			}
+
+			// pushing the replicas of an autoscaled deployment would undo the scaling of its autoscaler
+			autoscaled, err := deploymentAutoscaled(iface, namespace, next.Name)
+			if err != nil {
+				return nil, err
+			}
+			if autoscaled {
+				next.Spec.Replicas = liveDeployment.Spec.Replicas
+			}
+			return &next, nil
+		},
+	}
+}
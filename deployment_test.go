@@ -1,12 +1,16 @@
 package kube_builders_test
 
 import (
+	"math"
+
 	. "github.com/Twister915/kube_builders"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/pkg/apis/extensions/v1beta1"
 )
 
 var _ = Describe("Deployment Builder", func() {
@@ -97,7 +101,123 @@ var _ = Describe("Deployment Builder", func() {
 	})
 
 	It("can push to kubernetes", func() {
-		_, err := bigDeploy().Push()
+		_, _, err := bigDeploy().Push()
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("configures the rollout strategy", func() {
+		deployment := tinyDeploy().RollingUpdate("25%", 1).MinReadySeconds(5).ProgressDeadlineSeconds(60).Paused(true).AsKube()
+		Expect(deployment.Spec.Strategy.Type).To(Equal(v1beta1.RollingUpdateDeploymentStrategyType))
+		Expect(deployment.Spec.Strategy.RollingUpdate.MaxSurge.String()).To(Equal("25%"))
+		Expect(deployment.Spec.Strategy.RollingUpdate.MaxUnavailable.IntValue()).To(Equal(1))
+		Expect(deployment.Spec.MinReadySeconds).To(BeEquivalentTo(5))
+		Expect(*deployment.Spec.ProgressDeadlineSeconds).To(BeEquivalentTo(60))
+		Expect(deployment.Spec.Paused).To(BeTrue())
+
+		By("recreating pods instead")
+		deployment = tinyDeploy().RollingUpdate(1, 1).Recreate().AsKube()
+		Expect(deployment.Spec.Strategy.Type).To(Equal(v1beta1.RecreateDeploymentStrategyType))
+		Expect(deployment.Spec.Strategy.RollingUpdate).To(BeNil())
+
+		By("rejecting values that are not ints or percentages")
+		Expect(func() { tinyDeploy().RollingUpdate("lots", 1) }).To(Panic())
+	})
+
+	It("selects its pods", func() {
+		deployment := tinyDeploy().AsKube()
+		Expect(deployment.Spec.Selector).ToNot(BeNil())
+		Expect(deployment.Spec.Selector.MatchLabels).To(Equal(deployment.Spec.Template.Labels))
+		Expect(deployment.Spec.Selector.MatchLabels).To(HaveKeyWithValue("app", name))
+
+		By("using an explicit selector")
+		deployment = tinyDeploy().Selector("app", "other").AsKube()
+		Expect(deployment.Spec.Selector.MatchLabels).To(Equal(map[string]string{"app": "other"}))
+		Expect(deployment.Spec.Template.Labels).To(Equal(map[string]string{"app": "other"}))
+		_, _, err := tinyDeploy().Selector("app", "other").Push()
+		Expect(err).ToNot(HaveOccurred())
+
+		By("refusing to push a selector that does not match the pods")
+		labeled := kubeTarget.NewPod("", namespace).Label("app", name).Container(containerName, containerImage, func(ctr ContainerBuilder) ContainerBuilder {
+			return ctr
+		}).Deployment(name)
+		_, _, err = labeled.Selector("app", "other").Push()
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("detects selector changes", func() {
+		labeled := func(value string) DeploymentBuilder {
+			return kubeTarget.NewPod("", namespace).Label("app", value).Container(containerName, containerImage, func(ctr ContainerBuilder) ContainerBuilder {
+				return ctr
+			}).Deployment(name)
+		}
+		_, _, err := labeled("one").Push()
+		Expect(err).ToNot(HaveOccurred())
+
+		By("failing by default")
+		_, _, err = labeled("two").Push()
+		Expect(err).To(HaveOccurred())
+
+		By("recreating when asked to")
+		deployment, result, err := labeled("two").RecreateOnSelectorChange().Push()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Operation).To(Equal(OperationRecreated))
+		Expect(deployment.Spec.Selector.MatchLabels).To(HaveKeyWithValue("app", "two"))
+	})
+
+	It("reports the outcome of each push", func() {
+		_, result, err := bigDeploy().Push()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Operation).To(Equal(OperationCreated))
+
+		By("skipping updates when nothing changed")
+		_, result, err = bigDeploy().Push()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Operation).To(Equal(OperationUnchanged))
+
+		By("updating when something changed")
+		_, result, err = bigDeploy().Replicas(replicas + 1).Push()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Operation).To(Equal(OperationUpdated))
+	})
+
+	It("keeps the history and progress deadline the server defaulted", func() {
+		unset := func() DeploymentBuilder {
+			return kubeTarget.NewPod("", namespace).Container(containerName, containerImage, func(ctr ContainerBuilder) ContainerBuilder {
+				return ctr
+			}).Deployment(name).Replicas(replicas)
+		}
+		_, _, err := unset().Push()
+		Expect(err).ToNot(HaveOccurred())
+
+		live, err := fakeKubernetes.ExtensionsV1beta1().Deployments(namespace).Get(name, meta_v1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		maxInt32 := int32(math.MaxInt32)
+		live.Spec.RevisionHistoryLimit = &maxInt32
+		live.Spec.ProgressDeadlineSeconds = &maxInt32
+		_, err = fakeKubernetes.ExtensionsV1beta1().Deployments(namespace).Update(live)
+		Expect(err).ToNot(HaveOccurred())
+
+		diff, err := unset().Diff()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(diff.Changed()).To(BeFalse())
+		_, result, err := unset().Push()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Operation).To(Equal(OperationUnchanged))
+
+		By("still setting them when configured")
+		deployment, result, err := unset().History(history).Push()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Operation).To(Equal(OperationUpdated))
+		Expect(*deployment.Spec.RevisionHistoryLimit).To(BeEquivalentTo(history))
+	})
+
+	It("updates when a label is removed", func() {
+		_, _, err := bigDeploy().Label("team", "web").Push()
+		Expect(err).ToNot(HaveOccurred())
+
+		deployment, result, err := bigDeploy().Push()
 		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Operation).To(Equal(OperationUpdated))
+		Expect(deployment.Labels).ToNot(HaveKey("team"))
 	})
 })
@@ -0,0 +1,156 @@
+package kube_builders
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	"github.com/pmezard/go-difflib/difflib"
+	kube_errors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+// ObjectDiff is the difference between an object produced by a builder and the object currently live on
+// the cluster. Labels, annotations, spec and data are compared in full, so fields dropped from the
+// builder show up as removals; status and server populated metadata are ignored. Secret values are
+// replaced by a hash of their content.
+type ObjectDiff struct {
+	Kind      string
+	Namespace string
+	Name      string
+
+	// Exists is false when the object is not on the cluster yet, in which case Fields is empty and
+	// Unified adds the whole object.
+	Exists  bool
+	Fields  []FieldDiff
+	Unified string
+}
+
+func (diff ObjectDiff) Changed() bool {
+	return !diff.Exists || len(diff.Fields) > 0
+}
+
+// Diff compares objects with their live versions. Custom resources made by the builders, such as
+// gateways, are compared through the dynamic client.
+func (kube *KubeTarget) Diff(objects ...runtime.Object) (diffs []ObjectDiff, err error) {
+	for _, obj := range objects {
+		var diff ObjectDiff
+		diff, err = kube.diff(obj)
+		if err != nil {
+			return
+		}
+		diffs = append(diffs, diff)
+	}
+	return
+}
+
+func (kube *KubeTarget) diff(desired runtime.Object) (diff ObjectDiff, err error) {
+	var client objectClient
+	if obj, ok := desired.(*unstructured.Unstructured); ok {
+		client, err = kube.unstructuredClient(obj)
+	} else {
+		client, err = clientFor(desired, kube.iface)
+	}
+	if err != nil {
+		return
+	}
+	return client.diff(desired)
+}
+
+// diff compares desired with the live object the way push does, so fields push takes from the live object
+// don't show up as changes.
+func (client objectClient) diff(desired runtime.Object) (diff ObjectDiff, err error) {
+	accessor, err := meta.Accessor(desired)
+	if err != nil {
+		return
+	}
+	diff.Kind = client.kind
+	diff.Namespace = accessor.GetNamespace()
+	diff.Name = accessor.GetName()
+
+	desiredFields, err := compareFields(desired)
+	if err != nil {
+		return
+	}
+	redactSecretData(desired, desiredFields)
+
+	var liveFields map[string]interface{}
+	live, err := client.get(diff.Name)
+	if kube_errors.IsNotFound(err) {
+		err = nil
+	} else if err != nil {
+		err = errors.Wrapf(err, "failed to get current %s %s", client.kind, diff.Name)
+		return
+	} else {
+		diff.Exists = true
+		if client.prepare != nil {
+			if desired, err = client.prepare(live, desired); err != nil {
+				return
+			}
+			if desiredFields, err = compareFields(desired); err != nil {
+				return
+			}
+			redactSecretData(desired, desiredFields)
+		}
+		if liveFields, err = compareFields(live); err != nil {
+			return
+		}
+		redactSecretData(live, liveFields)
+
+		diff.Fields = diffFields("", desiredFields, liveFields, nil)
+		sortFieldDiffs(diff.Fields)
+		if !diff.Changed() {
+			return
+		}
+	}
+
+	var liveDocument interface{}
+	if diff.Exists {
+		liveDocument = liveFields
+	}
+	title := fmt.Sprintf("%s %s/%s", client.kind, diff.Namespace, diff.Name)
+	diff.Unified, err = unifiedDiff(liveDocument, desiredFields, "live "+title, "desired "+title)
+	return
+}
+
+// unifiedDiff renders both values as YAML and diffs them. A nil value is treated as an empty document.
+func unifiedDiff(from, to interface{}, fromName, toName string) (unified string, err error) {
+	var fromYaml, toYaml []byte
+	if from != nil {
+		if fromYaml, err = yaml.Marshal(from); err != nil {
+			return
+		}
+	}
+	if to != nil {
+		if toYaml, err = yaml.Marshal(to); err != nil {
+			return
+		}
+	}
+
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(fromYaml)),
+		B:        difflib.SplitLines(string(toYaml)),
+		FromFile: fromName,
+		ToFile:   toName,
+		Context:  3,
+	})
+}
+
+func redactSecretData(obj runtime.Object, fields map[string]interface{}) {
+	if _, ok := obj.(*v1.Secret); !ok {
+		return
+	}
+	data, ok := fields["data"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	for key, value := range data {
+		encoded, _ := json.Marshal(value)
+		data[key] = fmt.Sprintf("<redacted sha256:%x>", sha256.Sum256(encoded))
+	}
+}
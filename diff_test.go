@@ -0,0 +1,80 @@
+package kube_builders_test
+
+import (
+	. "github.com/Twister915/kube_builders"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var _ = Describe("Diff", func() {
+	const (
+		namespace = "test"
+		name      = "test"
+
+		containerName  = "web"
+		containerImage = "docker.spectonic.com/test/123"
+	)
+
+	var (
+		fakeKubernetes kubernetes.Interface
+		kubeTarget     *KubeTarget
+	)
+
+	deploy := func(image string) DeploymentBuilder {
+		return kubeTarget.NewPod("", namespace).Container(containerName, image, func(ctr ContainerBuilder) ContainerBuilder {
+			return ctr
+		}).Deployment(name).Replicas(2)
+	}
+
+	BeforeEach(func() {
+		fakeKubernetes = fake.NewSimpleClientset()
+		kubeTarget = NewKubeTarget(fakeKubernetes)
+	})
+
+	It("reports objects that do not exist yet", func() {
+		diff, err := deploy(containerImage).Diff()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(diff.Exists).To(BeFalse())
+		Expect(diff.Changed()).To(BeTrue())
+		Expect(diff.Unified).To(ContainSubstring(containerImage))
+	})
+
+	It("reports changed fields", func() {
+		_, _, err := deploy(containerImage).Push()
+		Expect(err).ToNot(HaveOccurred())
+
+		diff, err := deploy(containerImage + "-next").Diff()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(diff.Exists).To(BeTrue())
+		Expect(diff.Fields).To(ConsistOf(FieldDiff{
+			Path:    "spec.template.spec.containers[0].image",
+			Live:    containerImage,
+			Desired: containerImage + "-next",
+		}))
+		Expect(diff.Unified).To(MatchRegexp(`(?m)^-\s+- image: ` + containerImage + `$`))
+		Expect(diff.Unified).To(MatchRegexp(`(?m)^\+\s+- image: ` + containerImage + `-next$`))
+	})
+
+	It("ignores server populated fields", func() {
+		_, _, err := deploy(containerImage).Push()
+		Expect(err).ToNot(HaveOccurred())
+
+		deployments := fakeKubernetes.ExtensionsV1beta1().Deployments(namespace)
+		live, err := deployments.Get(name, meta_v1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		live.UID = "abc"
+		live.ResourceVersion = "12"
+		live.Status.Replicas = 2
+		_, err = deployments.Update(live)
+		Expect(err).ToNot(HaveOccurred())
+
+		diffs, err := kubeTarget.Diff(deploy(containerImage).AsKube())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(diffs).To(HaveLen(1))
+		Expect(diffs[0].Changed()).To(BeFalse())
+	})
+})
@@ -0,0 +1,212 @@
+package kube_builders
+
+import (
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/pkg/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/pkg/apis/policy/v1beta1"
+)
+
+// DisruptionBudgetBuilder builds a PodDisruptionBudget selecting the pods of a workload. Only one of
+// MinAvailable and MaxUnavailable can be set, the last one called wins.
+type DisruptionBudgetBuilder struct {
+	kube *KubeTarget
+
+	name      string
+	namespace string
+	workload  string
+
+	selector       *meta_v1.LabelSelector
+	minAvailable   *intstr.IntOrString
+	maxUnavailable *intstr.IntOrString
+
+	// replicas of the workload, 0 when it depends on the cluster like for a daemon set
+	replicas int
+
+	labels      map[string]string
+	annotations map[string]string
+}
+
+// DisruptionBudget returns a budget for the pods of the deployment, named after it.
+func (deployment DeploymentBuilder) DisruptionBudget() DisruptionBudgetBuilder {
+	replicas := deployment.replicas
+	if deployment.autoscaled && replicas < deployment.minReplicas {
+		replicas = deployment.minReplicas
+	}
+	if replicas == 0 {
+		replicas = 1
+	}
+	return DisruptionBudgetBuilder{
+		kube:      deployment.kube,
+		name:      deployment.name,
+		namespace: deployment.namespace,
+		workload:  "deployment " + deployment.name,
+		selector:  deployment.kubeObject().Spec.Selector,
+		replicas:  replicas,
+	}
+}
+
+// DisruptionBudget returns a budget for the pods of the daemon set, named after it.
+func (ds DaemonSetBuilder) DisruptionBudget() DisruptionBudgetBuilder {
+	return DisruptionBudgetBuilder{
+		kube:      ds.kube,
+		name:      ds.name,
+		namespace: ds.namespace,
+		workload:  "daemon set " + ds.name,
+		selector:  ds.kubeObject().Spec.Selector,
+	}
+}
+
+// MinAvailable is the number of pods, or percentage such as "50%", which must stay up during voluntary
+// disruptions like node drains.
+func (pdb DisruptionBudgetBuilder) MinAvailable(value interface{}) DisruptionBudgetBuilder {
+	minAvailable := intOrPercent(value)
+	pdb.minAvailable = &minAvailable
+	pdb.maxUnavailable = nil
+	return pdb
+}
+
+// MaxUnavailable is the number of pods, or percentage such as "25%", which may be down at once during
+// voluntary disruptions.
+func (pdb DisruptionBudgetBuilder) MaxUnavailable(value interface{}) DisruptionBudgetBuilder {
+	maxUnavailable := intOrPercent(value)
+	pdb.maxUnavailable = &maxUnavailable
+	pdb.minAvailable = nil
+	return pdb
+}
+
+func (pdb DisruptionBudgetBuilder) Label(label string, value interface{}) DisruptionBudgetBuilder {
+	setAtMap(&pdb.labels, label, value)
+	return pdb
+}
+
+func (pdb DisruptionBudgetBuilder) Annotation(annotation string, value interface{}) DisruptionBudgetBuilder {
+	setAtMap(&pdb.annotations, annotation, value)
+	return pdb
+}
+
+// Warnings lists problems with the budget which the server accepts, such as a budget that blocks every
+// eviction and so stops nodes from being drained.
+func (pdb DisruptionBudgetBuilder) Warnings() (warnings []string) {
+	if pdb.minAvailable == nil && pdb.maxUnavailable == nil {
+		warnings = append(warnings, fmt.Sprintf("disruption budget %s sets neither min available nor max unavailable", pdb.name))
+	}
+	if pdb.blocksEvictions() {
+		warnings = append(warnings, fmt.Sprintf("disruption budget %s blocks all evictions of %s", pdb.name, pdb.workload))
+	}
+	return
+}
+
+func (pdb DisruptionBudgetBuilder) blocksEvictions() bool {
+	// the size of a daemon set depends on the nodes, so it is checked against a nominal 100 pods where
+	// only the extremes of 0 unavailable or 100% available are caught
+	total := pdb.replicas
+	if total == 0 {
+		total = 100
+	}
+	switch {
+	case pdb.maxUnavailable != nil:
+		if pdb.replicas == 0 && pdb.maxUnavailable.Type == intstr.Int {
+			return pdb.maxUnavailable.IntValue() == 0
+		}
+		return budgetValue(*pdb.maxUnavailable, total, false) == 0
+	case pdb.minAvailable != nil:
+		if pdb.replicas == 0 && pdb.minAvailable.Type == intstr.Int {
+			return false
+		}
+		return budgetValue(*pdb.minAvailable, total, true) >= total
+	}
+	return false
+}
+
+// budgetValue resolves an int or percentage against total, rounding the way the disruption controller
+// does: up for min available and down for max unavailable.
+func budgetValue(value intstr.IntOrString, total int, roundUp bool) int {
+	if value.Type == intstr.Int {
+		return value.IntValue()
+	}
+	var percent int
+	fmt.Sscanf(value.StrVal, "%d%%", &percent)
+	scaled := float64(percent) * float64(total) / 100
+	if roundUp {
+		return int(math.Ceil(scaled))
+	}
+	return int(math.Floor(scaled))
+}
+
+func (pdb DisruptionBudgetBuilder) AsKube() (kubePdb *v1beta1.PodDisruptionBudget) {
+	kubePdb = new(v1beta1.PodDisruptionBudget)
+	kubePdb.TypeMeta = meta_v1.TypeMeta{Kind: "PodDisruptionBudget", APIVersion: v1beta1.SchemeGroupVersion.String()}
+	kubePdb.Name = pdb.name
+	kubePdb.Namespace = pdb.namespace
+	kubePdb.Annotations = pdb.annotations
+	kubePdb.Labels = pdb.labels
+	pdb.kube.stampProvenance(&kubePdb.ObjectMeta)
+
+	kubePdb.Spec.Selector = pdb.selector
+	kubePdb.Spec.MinAvailable = pdb.minAvailable
+	kubePdb.Spec.MaxUnavailable = pdb.maxUnavailable
+	return
+}
+
+func (pdb DisruptionBudgetBuilder) Render(w io.Writer, format Format) error {
+	return Render(w, format, pdb.AsKube())
+}
+
+func (pdb DisruptionBudgetBuilder) Diff() (ObjectDiff, error) {
+	return pdb.kube.diff(pdb.AsKube())
+}
+
+func (pdb DisruptionBudgetBuilder) Push() (kubePdb *v1beta1.PodDisruptionBudget, result PushResult, err error) {
+	kubePdb = pdb.AsKube()
+	result, err = pdb.kube.push(kubePdb)
+	result.Warnings = append(result.Warnings, pdb.Warnings()...)
+	if persisted, ok := result.Object.(*v1beta1.PodDisruptionBudget); ok {
+		kubePdb = persisted
+	}
+	return
+}
+
+func PushDisruptionBudget(kubePdb *v1beta1.PodDisruptionBudget, iface kubernetes.Interface) (result PushResult, err error) {
+	return disruptionBudgetClient(kubePdb.Namespace, iface).push(kubePdb, dryRunNone)
+}
+
+func disruptionBudgetClient(namespace string, iface kubernetes.Interface) objectClient {
+	pdbs := iface.PolicyV1beta1().PodDisruptionBudgets(namespace)
+	return objectClient{
+		kind:      "disruption budget",
+		resource:  "poddisruptionbudgets",
+		namespace: namespace,
+		rest:      iface.PolicyV1beta1().RESTClient(),
+		newObject: func() runtime.Object { return new(v1beta1.PodDisruptionBudget) },
+		get: func(name string) (runtime.Object, error) {
+			return pdbs.Get(name, meta_v1.GetOptions{})
+		},
+		create: func(obj runtime.Object) (runtime.Object, error) {
+			return pdbs.Create(obj.(*v1beta1.PodDisruptionBudget))
+		},
+		update: func(obj runtime.Object) (runtime.Object, error) {
+			return pdbs.Update(obj.(*v1beta1.PodDisruptionBudget))
+		},
+		delete: pdbs.Delete,
+		// policy/v1beta1 rejects any change to the spec, and replacing a budget doesn't disrupt anything
+		immutable:         disruptionBudgetImmutable,
+		recreateImmutable: true,
+	}
+}
+
+func disruptionBudgetImmutable(live, desired runtime.Object) (err error) {
+	liveSpec := &v1beta1.PodDisruptionBudget{Spec: live.(*v1beta1.PodDisruptionBudget).Spec}
+	desiredSpec := &v1beta1.PodDisruptionBudget{Spec: desired.(*v1beta1.PodDisruptionBudget).Spec}
+	equal, err := ownedFieldsEqual(liveSpec, desiredSpec)
+	if err == nil && !equal {
+		err = errors.New("spec of a disruption budget can't be changed")
+	}
+	return
+}
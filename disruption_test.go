@@ -0,0 +1,68 @@
+package kube_builders_test
+
+import (
+	. "github.com/Twister915/kube_builders"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var _ = Describe("Disruption Budget", func() {
+	const (
+		namespace = "test"
+		name      = "test"
+	)
+
+	var kubeTarget *KubeTarget
+
+	pod := func() PodBuilder {
+		return kubeTarget.NewPod("", namespace).Label("app", name).Label("tier", "web").Container("web", "image", func(ctr ContainerBuilder) ContainerBuilder {
+			return ctr
+		})
+	}
+
+	BeforeEach(func() {
+		kubeTarget = NewKubeTarget(fake.NewSimpleClientset())
+	})
+
+	It("selects the pods of the workload", func() {
+		pdb := pod().Deployment(name).Replicas(3).DisruptionBudget().MinAvailable(2).AsKube()
+		Expect(pdb.Name).To(Equal(name))
+		Expect(pdb.Spec.Selector.MatchLabels).To(Equal(map[string]string{"app": name, "tier": "web"}))
+		Expect(pdb.Spec.MinAvailable.IntValue()).To(Equal(2))
+		Expect(pdb.Spec.MaxUnavailable).To(BeNil())
+
+		pdb = pod().DaemonSet(name).Selector("app", name).DisruptionBudget().MaxUnavailable("10%").AsKube()
+		Expect(pdb.Spec.Selector.MatchLabels).To(Equal(map[string]string{"app": name}))
+		Expect(pdb.Spec.MaxUnavailable.String()).To(Equal("10%"))
+		Expect(pdb.Spec.MinAvailable).To(BeNil())
+	})
+
+	It("warns about budgets that block every eviction", func() {
+		Expect(pod().Deployment(name).Replicas(3).DisruptionBudget().MinAvailable(2).Warnings()).To(BeEmpty())
+		Expect(pod().Deployment(name).Replicas(3).DisruptionBudget().MinAvailable(3).Warnings()).To(HaveLen(1))
+		Expect(pod().Deployment(name).DisruptionBudget().MinAvailable("60%").Warnings()).To(HaveLen(1))
+		Expect(pod().Deployment(name).Replicas(3).DisruptionBudget().MaxUnavailable("25%").Warnings()).To(HaveLen(1))
+		Expect(pod().Deployment(name).Replicas(4).DisruptionBudget().MaxUnavailable("25%").Warnings()).To(BeEmpty())
+		Expect(pod().DaemonSet(name).DisruptionBudget().MinAvailable(5).Warnings()).To(BeEmpty())
+		Expect(pod().DaemonSet(name).DisruptionBudget().MinAvailable("100%").Warnings()).To(HaveLen(1))
+	})
+
+	It("pushes the budget and replaces it when the spec changes", func() {
+		_, result, err := pod().Deployment(name).Replicas(3).DisruptionBudget().MinAvailable(3).Push()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Operation).To(Equal(OperationCreated))
+		Expect(result.Warnings).To(HaveLen(1))
+
+		_, result, err = pod().Deployment(name).Replicas(3).DisruptionBudget().MinAvailable(3).Push()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Operation).To(Equal(OperationUnchanged))
+
+		pdb, result, err := pod().Deployment(name).Replicas(3).DisruptionBudget().MaxUnavailable(1).Push()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Operation).To(Equal(OperationRecreated))
+		Expect(pdb.Spec.MaxUnavailable.IntValue()).To(Equal(1))
+		Expect(pdb.Spec.MinAvailable).To(BeNil())
+	})
+})
@@ -0,0 +1,68 @@
+package kube_builders
+
+import (
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/discovery"
+)
+
+type dryRunMode int
+
+const (
+	dryRunNone dryRunMode = iota
+	dryRunLocal
+	dryRunServer
+)
+
+// server-side dry run went beta (and on by default) in 1.13
+const serverDryRunMinor = 13
+
+// DryRun returns a target whose pushes never modify the cluster. When the API server supports it each
+// write is sent with dryRun=All so admission and validation still run; otherwise the push is simulated
+// locally against the live objects.
+func (kube *KubeTarget) DryRun() *KubeTarget {
+	dry := *kube
+	if serverDryRunSupported(kube.iface.Discovery()) {
+		dry.dryRun = dryRunServer
+	} else {
+		dry.dryRun = dryRunLocal
+	}
+	return &dry
+}
+
+func (kube *KubeTarget) IsDryRun() bool {
+	return kube.dryRun != dryRunNone
+}
+
+func serverDryRunSupported(client discovery.DiscoveryInterface) bool {
+	info, err := client.ServerVersion()
+	if err != nil {
+		return false
+	}
+
+	major, err := strconv.Atoi(strings.TrimSuffix(info.Major, "+"))
+	if err != nil {
+		return false
+	}
+	minor, err := strconv.Atoi(strings.TrimSuffix(info.Minor, "+"))
+	if err != nil {
+		return false
+	}
+	return major > 1 || (major == 1 && minor >= serverDryRunMinor)
+}
+
+func (client objectClient) serverDryRun(verb, name string, obj runtime.Object) (persisted runtime.Object, err error) {
+	persisted = client.newObject()
+	req := client.rest.Verb(verb).
+		Namespace(client.namespace).
+		Resource(client.resource).
+		Param("dryRun", "All").
+		Body(obj)
+	if len(name) > 0 {
+		req = req.Name(name)
+	}
+	err = req.Do().Into(persisted)
+	return
+}
@@ -0,0 +1,70 @@
+package kube_builders_test
+
+import (
+	. "github.com/Twister915/kube_builders"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	kube_errors "k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var _ = Describe("Dry Run", func() {
+	const (
+		namespace = "test"
+		name      = "test"
+
+		containerName  = "web"
+		containerImage = "docker.spectonic.com/test/123"
+	)
+
+	var (
+		fakeKubernetes kubernetes.Interface
+		kubeTarget     *KubeTarget
+	)
+
+	deploy := func(target *KubeTarget, replicas int) DeploymentBuilder {
+		return target.NewPod("", namespace).Container(containerName, containerImage, func(ctr ContainerBuilder) ContainerBuilder {
+			return ctr
+		}).Deployment(name).Replicas(replicas)
+	}
+
+	BeforeEach(func() {
+		fakeKubernetes = fake.NewSimpleClientset()
+		kubeTarget = NewKubeTarget(fakeKubernetes)
+	})
+
+	It("does not create objects", func() {
+		deployment, result, err := deploy(kubeTarget.DryRun(), 2).Push()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.DryRun).To(BeTrue())
+		Expect(result.Operation).To(Equal(OperationCreated))
+		Expect(deployment.Name).To(Equal(name))
+
+		_, err = fakeKubernetes.ExtensionsV1beta1().Deployments(namespace).Get(name, meta_v1.GetOptions{})
+		Expect(kube_errors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("reports updates without applying them", func() {
+		By("pushing for real")
+		_, _, err := deploy(kubeTarget, 2).Push()
+		Expect(err).ToNot(HaveOccurred())
+
+		By("dry running the same deployment")
+		_, result, err := deploy(kubeTarget.DryRun(), 2).Push()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Operation).To(Equal(OperationUnchanged))
+
+		By("dry running a change")
+		deployment, result, err := deploy(kubeTarget.DryRun(), 3).Push()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Operation).To(Equal(OperationUpdated))
+		Expect(*deployment.Spec.Replicas).To(BeEquivalentTo(3))
+
+		live, err := fakeKubernetes.ExtensionsV1beta1().Deployments(namespace).Get(name, meta_v1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(*live.Spec.Replicas).To(BeEquivalentTo(2))
+	})
+})
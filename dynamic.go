@@ -0,0 +1,115 @@
+package kube_builders
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// WithDynamicClient returns a target which pushes custom resources, such as Gateway API objects, through
+// pool. Targets made with NewKubernetes already have one.
+func (kube *KubeTarget) WithDynamicClient(pool dynamic.ClientPool) *KubeTarget {
+	withDynamic := *kube
+	withDynamic.dynamic = pool
+	return &withDynamic
+}
+
+// dynamicClient is an objectClient for a namespaced custom resource, working on unstructured objects.
+// There is no typed REST client for these, so a server dry-run falls back to a local one.
+func (kube *KubeTarget) dynamicClient(kind schema.GroupVersionKind, description, resource, namespace string) (client objectClient, err error) {
+	if kube.dynamic == nil {
+		err = errors.Errorf("no dynamic client to push %s with, use WithDynamicClient", description)
+		return
+	}
+	dyn, err := kube.dynamic.ClientForGroupVersionKind(kind)
+	if err != nil {
+		err = errors.Wrapf(err, "failed to get a client for %s", description)
+		return
+	}
+	resources := dyn.Resource(&meta_v1.APIResource{Name: resource, Namespaced: true, Kind: kind.Kind}, namespace)
+
+	client = objectClient{
+		kind:      description,
+		resource:  resource,
+		namespace: namespace,
+		newObject: func() runtime.Object { return new(unstructured.Unstructured) },
+		get: func(name string) (runtime.Object, error) {
+			return resources.Get(name, meta_v1.GetOptions{})
+		},
+		create: func(obj runtime.Object) (runtime.Object, error) {
+			return resources.Create(obj.(*unstructured.Unstructured))
+		},
+		update: func(obj runtime.Object) (runtime.Object, error) {
+			return resources.Update(obj.(*unstructured.Unstructured))
+		},
+		delete:  resources.Delete,
+		prepare: prepareUnstructured,
+	}
+	return
+}
+
+// dynamicKinds are the kinds of custom resources the builders make, with the description and resource
+// their objectClient uses.
+var dynamicKinds = map[schema.GroupVersionKind]struct{ description, resource string }{
+	gatewayKind:    {"gateway", "gateways"},
+	httpRouteKind:  {"http route", "httproutes"},
+	autoscalerKind: {"horizontal pod autoscaler", "horizontalpodautoscalers"},
+}
+
+// unstructuredClient is the objectClient for a custom resource made by one of the builders.
+func (kube *KubeTarget) unstructuredClient(obj *unstructured.Unstructured) (client objectClient, err error) {
+	kind := obj.GroupVersionKind()
+	known, ok := dynamicKinds[kind]
+	if !ok {
+		err = errors.Errorf("unsupported object kind %s", kind)
+		return
+	}
+	return kube.dynamicClient(kind, known.description, known.resource, obj.GetNamespace())
+}
+
+// prepareUnstructured updates the labels, annotations and spec of the live object with the desired ones.
+func prepareUnstructured(live, desired runtime.Object) (runtime.Object, error) {
+	liveObj, desiredObj := live.(*unstructured.Unstructured), desired.(*unstructured.Unstructured)
+
+	next := &unstructured.Unstructured{Object: make(map[string]interface{})}
+	for key, value := range liveObj.Object {
+		next.Object[key] = value
+	}
+	metadata := make(map[string]interface{})
+	if liveMetadata, ok := liveObj.Object["metadata"].(map[string]interface{}); ok {
+		for key, value := range liveMetadata {
+			metadata[key] = value
+		}
+	}
+	next.Object["metadata"] = metadata
+	next.SetLabels(desiredObj.GetLabels())
+	next.SetAnnotations(desiredObj.GetAnnotations())
+	next.Object["spec"] = desiredObj.Object["spec"]
+	return next, nil
+}
+
+// toUnstructured builds an unstructured object of kind from metadata and a spec with json tags.
+func toUnstructured(kind schema.GroupVersionKind, meta meta_v1.ObjectMeta, spec interface{}) (obj *unstructured.Unstructured, err error) {
+	data, err := json.Marshal(struct {
+		meta_v1.TypeMeta `json:",inline"`
+		Metadata         meta_v1.ObjectMeta `json:"metadata"`
+		Spec             interface{}        `json:"spec"`
+	}{
+		TypeMeta: meta_v1.TypeMeta{APIVersion: kind.GroupVersion().String(), Kind: kind.Kind},
+		Metadata: meta,
+		Spec:     spec,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "encoding %s %s", kind.Kind, meta.Name)
+	}
+	obj = new(unstructured.Unstructured)
+	if err = obj.UnmarshalJSON(data); err != nil {
+		return nil, errors.Wrapf(err, "decoding %s %s", kind.Kind, meta.Name)
+	}
+	return
+}
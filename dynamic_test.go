@@ -0,0 +1,152 @@
+package kube_builders_test
+
+import (
+	"net/http"
+
+	. "github.com/Twister915/kube_builders"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+var _ = Describe("Dynamic client", func() {
+	const namespace = "test"
+
+	var (
+		server     *apiServer
+		kubeTarget *KubeTarget
+	)
+
+	BeforeEach(func() {
+		server = newAPIServer()
+		kubeTarget = server.target(fake.NewSimpleClientset())
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("creates, updates and leaves gateways alone", func() {
+		const path = "/apis/gateway.networking.k8s.io/v1/namespaces/test/gateways/public"
+		gw := func() GatewayBuilder {
+			return kubeTarget.Gateway("public", namespace, "nginx").HTTPListener("http", 80, "")
+		}
+
+		diff, err := gw().Diff()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(diff.Exists).To(BeFalse())
+
+		_, result, err := gw().Push()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Operation).To(Equal(OperationCreated))
+		Expect(field(server.object(path), "spec", "gatewayClassName")).To(Equal("nginx"))
+
+		By("skipping updates when nothing changed")
+		diff, err = gw().Diff()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(diff.Changed()).To(BeFalse())
+		_, result, err = gw().Push()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Operation).To(Equal(OperationUnchanged))
+		Expect(server.count(http.MethodPut)).To(BeZero())
+
+		By("updating when something changed")
+		obj, result, err := gw().Label("team", "web").HTTPListener("alt", 8080, "").Push()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Operation).To(Equal(OperationUpdated))
+		Expect(obj.GetLabels()).To(HaveKeyWithValue("team", "web"))
+		Expect(field(server.object(path), "spec", "listeners")).To(HaveLen(2))
+	})
+
+	It("creates, updates and leaves autoscalers alone", func() {
+		const path = "/apis/autoscaling/v2beta2/namespaces/test/horizontalpodautoscalers/web"
+		hpa := func() AutoscalerBuilder {
+			return kubeTarget.NewPod("", namespace).Container("web", "image", func(ctr ContainerBuilder) ContainerBuilder {
+				return ctr
+			}).Deployment("web").Autoscale(2, 10).CPUUtilization(70)
+		}
+
+		_, result, err := hpa().Push()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Operation).To(Equal(OperationCreated))
+
+		_, result, err = hpa().Push()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Operation).To(Equal(OperationUnchanged))
+
+		_, result, err = hpa().CPUUtilization(50).Push()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Operation).To(Equal(OperationUpdated))
+		Expect(field(server.object(path), "spec", "metrics", 0, "resource", "target", "averageUtilization")).To(BeEquivalentTo(50))
+	})
+
+	It("creates, updates and leaves services with newer fields alone", func() {
+		const path = "/api/v1/namespaces/test/services/web"
+		svc := func() ServiceBuilder {
+			return kubeTarget.Service("web", namespace).Selector("app", "web").PortByNumber("http", 80, 8080).
+				Type(v1.ServiceTypeLoadBalancer).LoadBalancerClass("example.com/internal")
+		}
+		server.defaults = func(obj map[string]interface{}) {
+			spec := obj["spec"].(map[string]interface{})
+			if _, exists := obj["metadata"].(map[string]interface{})["resourceVersion"]; !exists {
+				// newer than the typed client, so updates have to keep it as it is live
+				spec["clusterIPs"] = []interface{}{"10.0.0.1"}
+			}
+			for key, value := range map[string]interface{}{"sessionAffinity": "None", "externalTrafficPolicy": "Cluster"} {
+				if _, set := spec[key]; !set {
+					spec[key] = value
+				}
+			}
+			for _, port := range spec["ports"].([]interface{}) {
+				if _, set := port.(map[string]interface{})["protocol"]; !set {
+					port.(map[string]interface{})["protocol"] = "TCP"
+				}
+			}
+		}
+
+		_, result, err := svc().Push()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Operation).To(Equal(OperationCreated))
+		Expect(field(server.object(path), "spec", "loadBalancerClass")).To(Equal("example.com/internal"))
+
+		_, result, err = svc().Push()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Operation).To(Equal(OperationUnchanged))
+
+		kubeSvc, result, err := svc().SessionAffinityTimeout(600).Push()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Operation).To(Equal(OperationUpdated))
+		Expect(kubeSvc.Spec.SessionAffinity).To(Equal(v1.ServiceAffinityClientIP))
+		Expect(field(server.object(path), "spec", "sessionAffinityConfig", "clientIP", "timeoutSeconds")).To(BeEquivalentTo(600))
+		Expect(field(server.object(path), "spec", "loadBalancerClass")).To(Equal("example.com/internal"))
+		Expect(field(server.object(path), "spec", "clusterIPs")).To(Equal([]interface{}{"10.0.0.1"}))
+	})
+
+	It("creates, updates and leaves ingresses with path types alone", func() {
+		const path = "/apis/extensions/v1beta1/namespaces/test/ingresses/web"
+		ing := func() IngressBuilder {
+			return kubeTarget.Ingress("web", namespace, "test.spectonic.com").
+				Path("/", "web", 80).
+				Path("/healthz", "web", 80).
+				PathType("/healthz", PathTypeExact)
+		}
+
+		_, result, err := ing().Push()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Operation).To(Equal(OperationCreated))
+
+		_, result, err = ing().Push()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Operation).To(Equal(OperationUnchanged))
+
+		kubeIng, result, err := ing().PathType("/", PathTypePrefix).Push()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Operation).To(Equal(OperationUpdated))
+		Expect(kubeIng.Spec.Rules[0].HTTP.Paths).To(HaveLen(2))
+		paths := field(server.object(path), "spec", "rules", 0, "http", "paths")
+		Expect(field(paths, 0, "pathType")).To(Equal("Prefix"))
+		Expect(field(paths, 1, "pathType")).To(Equal("Exact"))
+	})
+})
@@ -0,0 +1,160 @@
+package kube_builders
+
+import (
+	"io"
+
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var (
+	gatewayKind   = schema.GroupVersionKind{Group: "gateway.networking.k8s.io", Version: "v1", Kind: "Gateway"}
+	httpRouteKind = schema.GroupVersionKind{Group: "gateway.networking.k8s.io", Version: "v1", Kind: "HTTPRoute"}
+)
+
+// GatewayBuilder builds a Gateway API Gateway. Gateways are custom resources, so they are pushed through
+// the dynamic client of the target.
+type GatewayBuilder struct {
+	kube *KubeTarget
+
+	name      string
+	namespace string
+	class     string
+
+	listeners []gatewayListener
+
+	labels      map[string]string
+	annotations map[string]string
+}
+
+type gatewayListener struct {
+	Name          string                `json:"name"`
+	Hostname      string                `json:"hostname,omitempty"`
+	Port          int                   `json:"port"`
+	Protocol      string                `json:"protocol"`
+	TLS           *gatewayTLS           `json:"tls,omitempty"`
+	AllowedRoutes *gatewayAllowedRoutes `json:"allowedRoutes,omitempty"`
+}
+
+type gatewayTLS struct {
+	Mode            string             `json:"mode"`
+	CertificateRefs []gatewayObjectRef `json:"certificateRefs"`
+}
+
+type gatewayAllowedRoutes struct {
+	Namespaces struct {
+		From string `json:"from"`
+	} `json:"namespaces"`
+}
+
+type gatewayObjectRef struct {
+	Name        string `json:"name"`
+	Namespace   string `json:"namespace,omitempty"`
+	SectionName string `json:"sectionName,omitempty"`
+	Port        int    `json:"port,omitempty"`
+	Weight      *int   `json:"weight,omitempty"`
+}
+
+func (kube *KubeTarget) Gateway(name, namespace, className string) GatewayBuilder {
+	return GatewayBuilder{kube: kube, name: name, namespace: namespace, class: className}
+}
+
+// HTTPListener accepts plain HTTP on port. An empty hostname accepts any host.
+func (gw GatewayBuilder) HTTPListener(name string, port int, hostname string) GatewayBuilder {
+	return gw.setListener(gatewayListener{Name: name, Hostname: hostname, Port: port, Protocol: "HTTP"})
+}
+
+// HTTPSListener terminates TLS on port with the certificate in secret.
+func (gw GatewayBuilder) HTTPSListener(name string, port int, hostname, secret string) GatewayBuilder {
+	return gw.setListener(gatewayListener{
+		Name:     name,
+		Hostname: hostname,
+		Port:     port,
+		Protocol: "HTTPS",
+		TLS:      &gatewayTLS{Mode: "Terminate", CertificateRefs: []gatewayObjectRef{{Name: secret}}},
+	})
+}
+
+// AllowRoutesFromAllNamespaces lets routes of any namespace attach to the listener, instead of only
+// those in the namespace of the gateway.
+func (gw GatewayBuilder) AllowRoutesFromAllNamespaces(listener string) GatewayBuilder {
+	listeners := append([]gatewayListener(nil), gw.listeners...)
+	for i := range listeners {
+		if listeners[i].Name == listener {
+			listeners[i].AllowedRoutes = new(gatewayAllowedRoutes)
+			listeners[i].AllowedRoutes.Namespaces.From = "All"
+		}
+	}
+	gw.listeners = listeners
+	return gw
+}
+
+func (gw GatewayBuilder) setListener(listener gatewayListener) GatewayBuilder {
+	listeners := append([]gatewayListener(nil), gw.listeners...)
+	for i := range listeners {
+		if listeners[i].Name == listener.Name {
+			listeners[i] = listener
+			gw.listeners = listeners
+			return gw
+		}
+	}
+	gw.listeners = append(listeners, listener)
+	return gw
+}
+
+func (gw GatewayBuilder) Label(label string, value interface{}) GatewayBuilder {
+	setAtMap(&gw.labels, label, value)
+	return gw
+}
+
+func (gw GatewayBuilder) Annotation(annotation string, value interface{}) GatewayBuilder {
+	setAtMap(&gw.annotations, annotation, value)
+	return gw
+}
+
+func (gw GatewayBuilder) AsKube() (*unstructured.Unstructured, error) {
+	meta := meta_v1.ObjectMeta{Name: gw.name, Namespace: gw.namespace, Labels: gw.labels, Annotations: gw.annotations}
+	gw.kube.stampProvenance(&meta)
+	return toUnstructured(gatewayKind, meta, struct {
+		GatewayClassName string            `json:"gatewayClassName"`
+		Listeners        []gatewayListener `json:"listeners"`
+	}{gw.class, gw.listeners})
+}
+
+func (gw GatewayBuilder) Render(w io.Writer, format Format) error {
+	obj, err := gw.AsKube()
+	if err != nil {
+		return err
+	}
+	return Render(w, format, obj)
+}
+
+func (gw GatewayBuilder) Diff() (diff ObjectDiff, err error) {
+	obj, err := gw.AsKube()
+	if err != nil {
+		return
+	}
+	return gw.kube.diff(obj)
+}
+
+func (gw GatewayBuilder) Push() (obj *unstructured.Unstructured, result PushResult, err error) {
+	if obj, err = gw.AsKube(); err != nil {
+		return
+	}
+	return pushUnstructured(gw.kube, obj, gatewayKind, "gateway", "gateways")
+}
+
+// pushUnstructured pushes a custom resource built by one of the builders, returning it as persisted.
+func pushUnstructured(kube *KubeTarget, obj *unstructured.Unstructured, kind schema.GroupVersionKind, description, resource string) (persisted *unstructured.Unstructured, result PushResult, err error) {
+	persisted = obj
+	client, err := kube.dynamicClient(kind, description, resource, obj.GetNamespace())
+	if err != nil {
+		return
+	}
+	result, err = client.push(obj, kube.dryRun)
+	if pushed, ok := result.Object.(*unstructured.Unstructured); ok {
+		persisted = pushed
+	}
+	return
+}
@@ -0,0 +1,117 @@
+package kube_builders_test
+
+import (
+	. "github.com/Twister915/kube_builders"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var _ = Describe("Gateway API", func() {
+	const (
+		namespace = "test"
+		gateway   = "public"
+		domain    = "test.spectonic.com"
+	)
+
+	var kubeTarget *KubeTarget
+
+	BeforeEach(func() {
+		kubeTarget = NewKubeTarget(fake.NewSimpleClientset())
+	})
+
+	It("builds gateways", func() {
+		gw := built(kubeTarget.Gateway(gateway, namespace, "nginx").
+			HTTPListener("http", 80, "").
+			HTTPSListener("https", 443, domain, "cert").
+			AllowRoutesFromAllNamespaces("https").
+			AsKube())
+
+		Expect(gw.GetKind()).To(Equal("Gateway"))
+		Expect(gw.GetAPIVersion()).To(Equal("gateway.networking.k8s.io/v1"))
+		Expect(field(gw.Object, "spec", "gatewayClassName")).To(Equal("nginx"))
+		Expect(field(gw.Object, "spec", "listeners")).To(HaveLen(2))
+		Expect(field(gw.Object, "spec", "listeners", 1, "tls", "certificateRefs", 0, "name")).To(Equal("cert"))
+		Expect(field(gw.Object, "spec", "listeners", 1, "allowedRoutes", "namespaces", "from")).To(Equal("All"))
+	})
+
+	It("builds routes with matches, filters and weighted backends", func() {
+		route := built(kubeTarget.HTTPRoute("web", namespace).Gateway(gateway, "https").Hostname(domain).
+			Rule(func(rule HTTPRouteRuleBuilder) HTTPRouteRuleBuilder {
+				return rule.Match(func(match HTTPRouteMatchBuilder) HTTPRouteMatchBuilder {
+					return match.PathPrefix("/api").Header("X-Canary", "true")
+				}).Backend("api-canary", 80, 10).Backend("api", 80, 90).SetRequestHeader("X-Env", "prod").RemoveRequestHeader("X-Debug")
+			}).
+			Rule(func(rule HTTPRouteRuleBuilder) HTTPRouteRuleBuilder {
+				return rule.PathPrefix("/old").Redirect("https", "new.spectonic.com", 301)
+			}).
+			AsKube())
+
+		Expect(field(route.Object, "spec", "hostnames", 0)).To(Equal(domain))
+		Expect(field(route.Object, "spec", "parentRefs", 0, "sectionName")).To(Equal("https"))
+		api := field(route.Object, "spec", "rules", 0)
+		Expect(field(api, "matches", 0, "path", "type")).To(Equal("PathPrefix"))
+		Expect(field(api, "matches", 0, "headers", 0, "name")).To(Equal("X-Canary"))
+		Expect(field(api, "backendRefs", 0, "weight")).To(BeNumerically("==", 10))
+		By("grouping header changes into one filter")
+		Expect(field(api, "filters")).To(HaveLen(1))
+		Expect(field(api, "filters", 0, "requestHeaderModifier", "remove", 0)).To(Equal("X-Debug"))
+		Expect(field(route.Object, "spec", "rules", 1, "filters", 0, "requestRedirect", "statusCode")).To(BeNumerically("==", 301))
+	})
+
+	It("converts ingresses into routes", func() {
+		routes := kubeTarget.Ingress("web", namespace, domain).
+			Path("/", "web", 80).
+			Path("/api", "api", 8080).
+			Host("admin.spectonic.com", func(host IngressHostBuilder) IngressHostBuilder { return host.Path("/", "admin", 80) }).
+			DefaultBackend("fallback", 80).
+			IngressClass("nginx").
+			Annotation("team", "web").
+			HTTPRoutes(gateway)
+
+		Expect(routes).To(HaveLen(3))
+		first := built(routes[0].AsKube())
+		Expect(first.GetName()).To(Equal("web-0"))
+		Expect(first.GetAnnotations()).To(Equal(map[string]string{"team": "web"}))
+		Expect(field(first.Object, "spec", "hostnames", 0)).To(Equal(domain))
+		Expect(field(first.Object, "spec", "parentRefs", 0, "name")).To(Equal(gateway))
+		Expect(field(first.Object, "spec", "rules")).To(HaveLen(2))
+		Expect(field(first.Object, "spec", "rules", 1, "backendRefs", 0, "name")).To(Equal("api"))
+
+		fallback := built(routes[2].AsKube())
+		By("serving the default backend for the hosts of the ingress only")
+		Expect(field(fallback.Object, "spec", "hostnames")).To(Equal([]interface{}{domain, "admin.spectonic.com"}))
+		Expect(field(fallback.Object, "spec", "rules", 0, "backendRefs", 0, "name")).To(Equal("fallback"))
+
+		single := kubeTarget.Ingress("web", namespace, domain).Path("/", "web", 80).HTTPRoutes(gateway)
+		Expect(built(single[0].AsKube()).GetName()).To(Equal("web"))
+
+		By("matching every path for an empty one")
+		catchAll := kubeTarget.Ingress("web", namespace, "").Path("", "web", 80).DefaultBackend("fallback", 80).HTTPRoutes(gateway)
+		Expect(field(built(catchAll[0].AsKube()).Object, "spec", "rules", 0, "matches", 0, "path", "value")).To(Equal("/"))
+		Expect(built(catchAll[1].AsKube()).Object["spec"]).ToNot(HaveKey("hostnames"))
+	})
+
+	It("keeps exact ingress paths exact", func() {
+		routes := kubeTarget.Ingress("web", namespace, domain).
+			Path("/", "web", 80).
+			Path("/healthz", "web", 80).
+			PathType("/healthz", PathTypeExact).
+			HTTPRoutes(gateway)
+
+		rules := field(built(routes[0].AsKube()).Object, "spec", "rules")
+		Expect(field(rules, 0, "matches", 0, "path", "type")).To(Equal("PathPrefix"))
+		Expect(field(rules, 1, "matches", 0, "path", "type")).To(Equal("Exact"))
+		Expect(field(rules, 1, "matches", 0, "path", "value")).To(Equal("/healthz"))
+	})
+
+	It("needs a dynamic client to push and diff", func() {
+		_, _, err := kubeTarget.HTTPRoute("web", namespace).Push()
+		Expect(err).To(MatchError(ContainSubstring("no dynamic client")))
+		_, err = kubeTarget.HTTPRoute("web", namespace).Diff()
+		Expect(err).To(MatchError(ContainSubstring("no dynamic client")))
+		_, err = kubeTarget.Diff(built(kubeTarget.Gateway(gateway, namespace, "nginx").AsKube()))
+		Expect(err).To(MatchError(ContainSubstring("no dynamic client")))
+	})
+})
@@ -0,0 +1,353 @@
+package kube_builders
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// HTTPRouteBuilder builds a Gateway API HTTPRoute, attached to one or more gateways. Like gateways,
+// routes are pushed through the dynamic client of the target.
+type HTTPRouteBuilder struct {
+	kube *KubeTarget
+
+	name      string
+	namespace string
+
+	parents   []gatewayObjectRef
+	hostnames []string
+	rules     []httpRouteRule
+
+	labels      map[string]string
+	annotations map[string]string
+}
+
+type httpRouteRule struct {
+	Matches     []httpRouteMatch   `json:"matches,omitempty"`
+	Filters     []httpRouteFilter  `json:"filters,omitempty"`
+	BackendRefs []gatewayObjectRef `json:"backendRefs,omitempty"`
+}
+
+type httpRouteMatch struct {
+	Path    *httpPathMatch    `json:"path,omitempty"`
+	Headers []httpHeaderMatch `json:"headers,omitempty"`
+	Method  string            `json:"method,omitempty"`
+}
+
+type httpPathMatch struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type httpHeaderMatch struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type httpRouteFilter struct {
+	Type                   string               `json:"type"`
+	RequestRedirect        *httpRequestRedirect `json:"requestRedirect,omitempty"`
+	RequestHeaderModifier  *httpHeaderModifier  `json:"requestHeaderModifier,omitempty"`
+	ResponseHeaderModifier *httpHeaderModifier  `json:"responseHeaderModifier,omitempty"`
+}
+
+type httpRequestRedirect struct {
+	Scheme     string `json:"scheme,omitempty"`
+	Hostname   string `json:"hostname,omitempty"`
+	StatusCode int    `json:"statusCode,omitempty"`
+}
+
+type httpHeaderModifier struct {
+	Set    []httpHeaderMatch `json:"set,omitempty"`
+	Remove []string          `json:"remove,omitempty"`
+}
+
+// HTTPRouteRuleBuilder configures one rule of a route: which requests it matches, how they are changed
+// and which services they are sent to.
+type HTTPRouteRuleBuilder struct {
+	rule httpRouteRule
+}
+
+// HTTPRouteMatchBuilder configures one match of a rule. Every condition of a match must hold, while a
+// rule applies when any of its matches does.
+type HTTPRouteMatchBuilder struct {
+	match httpRouteMatch
+}
+
+func (kube *KubeTarget) HTTPRoute(name, namespace string) HTTPRouteBuilder {
+	return HTTPRouteBuilder{kube: kube, name: name, namespace: namespace}
+}
+
+// Gateway attaches the route to a gateway, and to one of its listeners when listener isn't empty.
+func (route HTTPRouteBuilder) Gateway(gateway, listener string) HTTPRouteBuilder {
+	route.parents = append(append([]gatewayObjectRef(nil), route.parents...), gatewayObjectRef{Name: gateway, SectionName: listener})
+	return route
+}
+
+// Hostname restricts the route to requests for the given hosts. Without any it applies to every host of
+// the listeners it is attached to.
+func (route HTTPRouteBuilder) Hostname(hosts ...string) HTTPRouteBuilder {
+	route.hostnames = append(append([]string(nil), route.hostnames...), hosts...)
+	return route
+}
+
+func (route HTTPRouteBuilder) Rule(builder func(HTTPRouteRuleBuilder) HTTPRouteRuleBuilder) HTTPRouteBuilder {
+	route.rules = append(append([]httpRouteRule(nil), route.rules...), builder(HTTPRouteRuleBuilder{}).rule)
+	return route
+}
+
+func (route HTTPRouteBuilder) Label(label string, value interface{}) HTTPRouteBuilder {
+	setAtMap(&route.labels, label, value)
+	return route
+}
+
+func (route HTTPRouteBuilder) Annotation(annotation string, value interface{}) HTTPRouteBuilder {
+	setAtMap(&route.annotations, annotation, value)
+	return route
+}
+
+func (rule HTTPRouteRuleBuilder) Match(builder func(HTTPRouteMatchBuilder) HTTPRouteMatchBuilder) HTTPRouteRuleBuilder {
+	rule.rule.Matches = append(append([]httpRouteMatch(nil), rule.rule.Matches...), builder(HTTPRouteMatchBuilder{}).match)
+	return rule
+}
+
+// PathPrefix matches requests for path and everything below it.
+func (rule HTTPRouteRuleBuilder) PathPrefix(path string) HTTPRouteRuleBuilder {
+	return rule.Match(func(match HTTPRouteMatchBuilder) HTTPRouteMatchBuilder { return match.PathPrefix(path) })
+}
+
+// Backend sends a share of the matched requests to a service. Weights are relative to the other
+// backends of the rule, and a weight of 0 leaves the default of 1.
+func (rule HTTPRouteRuleBuilder) Backend(service string, port, weight int) HTTPRouteRuleBuilder {
+	ref := gatewayObjectRef{Name: service, Port: port}
+	if weight > 0 {
+		ref.Weight = &weight
+	}
+	rule.rule.BackendRefs = append(append([]gatewayObjectRef(nil), rule.rule.BackendRefs...), ref)
+	return rule
+}
+
+// Redirect answers matched requests with a redirect instead of forwarding them. Empty values keep the
+// scheme or hostname of the request, and a status code of 0 uses 302.
+func (rule HTTPRouteRuleBuilder) Redirect(scheme, hostname string, statusCode int) HTTPRouteRuleBuilder {
+	return rule.addFilter(httpRouteFilter{
+		Type:            "RequestRedirect",
+		RequestRedirect: &httpRequestRedirect{Scheme: scheme, Hostname: hostname, StatusCode: statusCode},
+	})
+}
+
+func (rule HTTPRouteRuleBuilder) SetRequestHeader(name, value string) HTTPRouteRuleBuilder {
+	return rule.requestHeaders(func(modifier *httpHeaderModifier) {
+		modifier.Set = append(modifier.Set, httpHeaderMatch{Name: name, Value: value})
+	})
+}
+
+func (rule HTTPRouteRuleBuilder) RemoveRequestHeader(name string) HTTPRouteRuleBuilder {
+	return rule.requestHeaders(func(modifier *httpHeaderModifier) {
+		modifier.Remove = append(modifier.Remove, name)
+	})
+}
+
+func (rule HTTPRouteRuleBuilder) SetResponseHeader(name, value string) HTTPRouteRuleBuilder {
+	return rule.responseHeaders(func(modifier *httpHeaderModifier) {
+		modifier.Set = append(modifier.Set, httpHeaderMatch{Name: name, Value: value})
+	})
+}
+
+func (rule HTTPRouteRuleBuilder) RemoveResponseHeader(name string) HTTPRouteRuleBuilder {
+	return rule.responseHeaders(func(modifier *httpHeaderModifier) {
+		modifier.Remove = append(modifier.Remove, name)
+	})
+}
+
+func (rule HTTPRouteRuleBuilder) requestHeaders(update func(*httpHeaderModifier)) HTTPRouteRuleBuilder {
+	return rule.modifyFilter("RequestHeaderModifier", func(filter *httpRouteFilter) {
+		if filter.RequestHeaderModifier == nil {
+			filter.RequestHeaderModifier = new(httpHeaderModifier)
+		}
+		update(filter.RequestHeaderModifier)
+	})
+}
+
+func (rule HTTPRouteRuleBuilder) responseHeaders(update func(*httpHeaderModifier)) HTTPRouteRuleBuilder {
+	return rule.modifyFilter("ResponseHeaderModifier", func(filter *httpRouteFilter) {
+		if filter.ResponseHeaderModifier == nil {
+			filter.ResponseHeaderModifier = new(httpHeaderModifier)
+		}
+		update(filter.ResponseHeaderModifier)
+	})
+}
+
+// modifyFilter updates the filter of a type, which may only appear once in a rule, adding it when
+// missing. Filters are copied as other copies of the builder may share them.
+func (rule HTTPRouteRuleBuilder) modifyFilter(filterType string, update func(*httpRouteFilter)) HTTPRouteRuleBuilder {
+	filters := append([]httpRouteFilter(nil), rule.rule.Filters...)
+	for i := range filters {
+		if filters[i].Type == filterType {
+			filter := filters[i]
+			if filter.RequestHeaderModifier != nil {
+				filter.RequestHeaderModifier = filter.RequestHeaderModifier.copy()
+			}
+			if filter.ResponseHeaderModifier != nil {
+				filter.ResponseHeaderModifier = filter.ResponseHeaderModifier.copy()
+			}
+			update(&filter)
+			filters[i] = filter
+			rule.rule.Filters = filters
+			return rule
+		}
+	}
+	filter := httpRouteFilter{Type: filterType}
+	update(&filter)
+	rule.rule.Filters = append(filters, filter)
+	return rule
+}
+
+func (rule HTTPRouteRuleBuilder) addFilter(filter httpRouteFilter) HTTPRouteRuleBuilder {
+	rule.rule.Filters = append(append([]httpRouteFilter(nil), rule.rule.Filters...), filter)
+	return rule
+}
+
+func (modifier *httpHeaderModifier) copy() *httpHeaderModifier {
+	return &httpHeaderModifier{
+		Set:    append([]httpHeaderMatch(nil), modifier.Set...),
+		Remove: append([]string(nil), modifier.Remove...),
+	}
+}
+
+func (match HTTPRouteMatchBuilder) PathPrefix(path string) HTTPRouteMatchBuilder {
+	match.match.Path = &httpPathMatch{Type: "PathPrefix", Value: path}
+	return match
+}
+
+func (match HTTPRouteMatchBuilder) PathExact(path string) HTTPRouteMatchBuilder {
+	match.match.Path = &httpPathMatch{Type: "Exact", Value: path}
+	return match
+}
+
+func (match HTTPRouteMatchBuilder) Header(name, value string) HTTPRouteMatchBuilder {
+	match.match.Headers = append(append([]httpHeaderMatch(nil), match.match.Headers...), httpHeaderMatch{Name: name, Value: value})
+	return match
+}
+
+func (match HTTPRouteMatchBuilder) Method(method string) HTTPRouteMatchBuilder {
+	match.match.Method = method
+	return match
+}
+
+func (route HTTPRouteBuilder) AsKube() (*unstructured.Unstructured, error) {
+	meta := meta_v1.ObjectMeta{Name: route.name, Namespace: route.namespace, Labels: route.labels, Annotations: route.annotations}
+	route.kube.stampProvenance(&meta)
+	return toUnstructured(httpRouteKind, meta, struct {
+		ParentRefs []gatewayObjectRef `json:"parentRefs,omitempty"`
+		Hostnames  []string           `json:"hostnames,omitempty"`
+		Rules      []httpRouteRule    `json:"rules,omitempty"`
+	}{route.parents, route.hostnames, route.rules})
+}
+
+func (route HTTPRouteBuilder) Render(w io.Writer, format Format) error {
+	obj, err := route.AsKube()
+	if err != nil {
+		return err
+	}
+	return Render(w, format, obj)
+}
+
+func (route HTTPRouteBuilder) Diff() (diff ObjectDiff, err error) {
+	obj, err := route.AsKube()
+	if err != nil {
+		return
+	}
+	return route.kube.diff(obj)
+}
+
+func (route HTTPRouteBuilder) Push() (obj *unstructured.Unstructured, result PushResult, err error) {
+	if obj, err = route.AsKube(); err != nil {
+		return
+	}
+	return pushUnstructured(route.kube, obj, httpRouteKind, "http route", "httproutes")
+}
+
+// HTTPRoutes converts the ingress into routes attached to gateway, one per host since the rules of a
+// route apply to all of its hostnames. Routes are named after the ingress, with the position of the host
+// appended when there are several. Exact ingress paths become exact matches and all others path
+// prefixes, with an empty path standing for all of them. A default backend becomes a route for the hosts
+// of the ingress, or for every host of the gateway when a rule of the ingress has no host, so it doesn't
+// take over hosts other routes attach to the gateway. TLS is configured on the listeners of the gateway
+// instead.
+func (ing IngressBuilder) HTTPRoutes(gateway string) (routes []HTTPRouteBuilder) {
+	hosts := ing.sortedHosts()
+	count := len(hosts)
+	if ing.defaultBackend != nil {
+		count++
+	}
+	name := func(i int) string {
+		if count == 1 {
+			return ing.name
+		}
+		return fmt.Sprintf("%s-%d", ing.name, i)
+	}
+
+	for i, host := range hosts {
+		route := ing.kube.HTTPRoute(name(i), ing.namespace).Gateway(gateway, "")
+		if len(host.host) > 0 {
+			route = route.Hostname(host.host)
+		}
+		for _, path := range host.paths {
+			target := path.target
+			if len(path.path) == 0 {
+				path.path = "/"
+			}
+			route = route.Rule(func(rule HTTPRouteRuleBuilder) HTTPRouteRuleBuilder {
+				if path.pathType == PathTypeExact {
+					return rule.Match(func(match HTTPRouteMatchBuilder) HTTPRouteMatchBuilder { return match.PathExact(path.path) }).
+						Backend(target.service, target.port, 0)
+				}
+				return rule.PathPrefix(path.path).Backend(target.service, target.port, 0)
+			})
+		}
+		routes = append(routes, route.withMetadata(ing.labels, ing.annotations))
+	}
+	if ing.defaultBackend != nil {
+		target := *ing.defaultBackend
+		route := ing.kube.HTTPRoute(name(len(hosts)), ing.namespace).Gateway(gateway, "").Rule(func(rule HTTPRouteRuleBuilder) HTTPRouteRuleBuilder {
+			return rule.Backend(target.service, target.port, 0)
+		})
+		var hostnames []string
+		for _, host := range hosts {
+			if len(host.host) == 0 {
+				// a rule without a host serves every host already
+				hostnames = nil
+				break
+			}
+			hostnames = append(hostnames, host.host)
+		}
+		route = route.Hostname(hostnames...)
+		routes = append(routes, route.withMetadata(ing.labels, ing.annotations))
+	}
+	return
+}
+
+// withMetadata copies the labels and annotations of the ingress, except those of ingress controllers.
+func (route HTTPRouteBuilder) withMetadata(labels, annotations map[string]string) HTTPRouteBuilder {
+	route.labels = copyMap(labels)
+	for key, value := range annotations {
+		if key == ingressClassAnnotation || key == tlsAcmeAnnotation || hasAnyPrefix(key, nginxPrefix, traefikPrefix, traefikGenericPrefix) {
+			continue
+		}
+		route = route.Annotation(key, value)
+	}
+	return route
+}
+
+func hasAnyPrefix(s string, prefixes ...string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,9 +1,14 @@
 package kube_builders
 
 import (
-	"github.com/pkg/errors"
-	kube_errors "k8s.io/apimachinery/pkg/api/errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
 	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/pkg/apis/extensions/v1beta1"
@@ -16,34 +21,152 @@ type IngressBuilder struct {
 	namespace string
 	host      string
 
-	paths     map[string]ingressServiceTarget
-	tlsSecret string
+	hosts          []ingressHost
+	defaultBackend *ingressServiceTarget
+	tlsSecret      string
+	tls            []ingressTLS
+	sorted         bool
+	preflight      bool
 
 	labels      map[string]string
 	annotations map[string]string
 }
 
+type ingressHost struct {
+	host  string
+	paths []ingressPath
+}
+
+type ingressPath struct {
+	path     string
+	pathType string
+	target   ingressServiceTarget
+}
+
+// Path types say how an ingress path matches request paths.
+const (
+	// PathTypePrefix matches the path and everything below it, element by element.
+	PathTypePrefix = "Prefix"
+	// PathTypeExact matches the path only.
+	PathTypeExact = "Exact"
+	// PathTypeImplementationSpecific leaves matching to the ingress controller. Paths are given it when
+	// no type is set.
+	PathTypeImplementationSpecific = "ImplementationSpecific"
+)
+
 type ingressServiceTarget struct {
 	service string
 	port    int
 }
 
+type ingressTLS struct {
+	secret string
+	hosts  []string
+}
+
+// IngressHostBuilder configures the paths served for one host of an ingress. How a path matches is up to
+// the ingress controller unless a path type is set.
+type IngressHostBuilder struct {
+	host  string
+	paths []ingressPath
+}
+
 func (kube *KubeTarget) Ingress(name, namespace, domain string) IngressBuilder {
 	return IngressBuilder{kube: kube, name: name, namespace: namespace, host: domain}
 }
 
+// Path routes a path of the domain the ingress was created for to a service.
 func (ing IngressBuilder) Path(path, service string, port int) IngressBuilder {
-	setAtMapDirect(&ing.paths, path, ingressServiceTarget{service: service, port: port})
+	return ing.Host(ing.host, func(host IngressHostBuilder) IngressHostBuilder {
+		return host.Path(path, service, port)
+	})
+}
+
+// PathType sets how a path added for the domain the ingress was created for matches.
+func (ing IngressBuilder) PathType(path, pathType string) IngressBuilder {
+	return ing.Host(ing.host, func(host IngressHostBuilder) IngressHostBuilder {
+		return host.PathType(path, pathType)
+	})
+}
+
+// Host configures the paths of another domain. All paths of a domain are grouped into a single rule, and
+// calling Host again for the same domain adds to its paths.
+func (ing IngressBuilder) Host(domain string, builder func(IngressHostBuilder) IngressHostBuilder) IngressBuilder {
+	hosts := append([]ingressHost(nil), ing.hosts...)
+	for i := range hosts {
+		if hosts[i].host == domain {
+			built := builder(IngressHostBuilder{host: domain, paths: hosts[i].paths})
+			hosts[i].paths = built.paths
+			ing.hosts = hosts
+			return ing
+		}
+	}
+	built := builder(IngressHostBuilder{host: domain})
+	ing.hosts = append(hosts, ingressHost{host: domain, paths: built.paths})
+	return ing
+}
+
+func (host IngressHostBuilder) Path(path, service string, port int) IngressHostBuilder {
+	target := ingressServiceTarget{service: service, port: port}
+	paths := append([]ingressPath(nil), host.paths...)
+	for i := range paths {
+		if paths[i].path == path {
+			paths[i].target = target
+			host.paths = paths
+			return host
+		}
+	}
+	host.paths = append(paths, ingressPath{path: path, target: target})
+	return host
+}
+
+// PathType sets how path matches, one of PathTypePrefix, PathTypeExact or
+// PathTypeImplementationSpecific. Ingresses with path types are pushed through the dynamic client, as
+// our typed client doesn't have them. It panics when the path wasn't added.
+func (host IngressHostBuilder) PathType(path, pathType string) IngressHostBuilder {
+	paths := append([]ingressPath(nil), host.paths...)
+	for i := range paths {
+		if paths[i].path == path {
+			paths[i].pathType = pathType
+			host.paths = paths
+			return host
+		}
+	}
+	panic(fmt.Sprintf("ingress host %q has no path %q", host.host, path))
+}
+
+// DefaultBackend receives requests which match no host or path.
+func (ing IngressBuilder) DefaultBackend(service string, port int) IngressBuilder {
+	ing.defaultBackend = &ingressServiceTarget{service: service, port: port}
+	return ing
+}
+
+// Sorted orders hosts and their paths lexically instead of the order they were added in.
+func (ing IngressBuilder) Sorted() IngressBuilder {
+	ing.sorted = true
 	return ing
 }
 
+// TLS terminates TLS with the certificate in secret for the domain the ingress was created for, or for
+// every host when it was created without one.
 func (ing IngressBuilder) TLS(secret string) IngressBuilder {
 	ing.tlsSecret = secret
 	return ing
 }
 
-func (ing IngressBuilder) TLSAcme() IngressBuilder {
-	return ing.Annotation("kubernetes.io/tls-acme", "true")
+// TLSHosts terminates TLS for hosts with the certificate in secret. Use it once per certificate when
+// hosts don't share one.
+func (ing IngressBuilder) TLSHosts(secret string, hosts ...string) IngressBuilder {
+	tls := append([]ingressTLS(nil), ing.tls...)
+	for i := range tls {
+		if tls[i].secret == secret {
+			tls[i].hosts = append(append([]string(nil), tls[i].hosts...), hosts...)
+			ing.tls = tls
+			return ing
+		}
+	}
+	ing.tls = append(tls, ingressTLS{secret: secret, hosts: hosts})
+	return ing
 }
 
 func (ing IngressBuilder) Label(label string, value interface{}) IngressBuilder {
@@ -56,54 +179,176 @@ func (ing IngressBuilder) Annotation(annotation string, value interface{}) Ingre
 	return ing
 }
 
+// sortedHosts returns the hosts with their paths, ordered when Sorted was called.
+func (ing IngressBuilder) sortedHosts() []ingressHost {
+	hosts := make([]ingressHost, 0, len(ing.hosts))
+	for _, host := range ing.hosts {
+		if len(host.paths) == 0 {
+			continue
+		}
+		paths := append([]ingressPath(nil), host.paths...)
+		if ing.sorted {
+			sort.SliceStable(paths, func(i, j int) bool { return paths[i].path < paths[j].path })
+		}
+		hosts = append(hosts, ingressHost{host: host.host, paths: paths})
+	}
+	if ing.sorted {
+		sort.SliceStable(hosts, func(i, j int) bool { return hosts[i].host < hosts[j].host })
+	}
+	return hosts
+}
+
+func (target ingressServiceTarget) asKube() v1beta1.IngressBackend {
+	return v1beta1.IngressBackend{ServiceName: target.service, ServicePort: intstr.FromInt(target.port)}
+}
+
 func (ing IngressBuilder) AsKube() (kubeIng *v1beta1.Ingress) {
 	kubeIng = new(v1beta1.Ingress)
+	kubeIng.TypeMeta = meta_v1.TypeMeta{Kind: "Ingress", APIVersion: v1beta1.SchemeGroupVersion.String()}
 
 	kubeIng.Name = ing.name
 	kubeIng.Namespace = ing.namespace
-	for path, service := range ing.paths {
-		kubeIng.Spec.Rules = append(kubeIng.Spec.Rules,
-			v1beta1.IngressRule{Host: ing.host,
-				IngressRuleValue: v1beta1.IngressRuleValue{
-					HTTP: &v1beta1.HTTPIngressRuleValue{
-						Paths: []v1beta1.HTTPIngressPath{
-							{Path: path,
-								Backend: v1beta1.IngressBackend{ServiceName: service.service,
-									ServicePort: intstr.FromInt(service.port)}},
-						},
-					},
-				}})
+	hosts := ing.sortedHosts()
+	for _, host := range hosts {
+		rule := v1beta1.IngressRule{Host: host.host, IngressRuleValue: v1beta1.IngressRuleValue{HTTP: new(v1beta1.HTTPIngressRuleValue)}}
+		for _, path := range host.paths {
+			rule.HTTP.Paths = append(rule.HTTP.Paths, v1beta1.HTTPIngressPath{Path: path.path, Backend: path.target.asKube()})
+		}
+		kubeIng.Spec.Rules = append(kubeIng.Spec.Rules, rule)
+	}
+	if ing.defaultBackend != nil {
+		backend := ing.defaultBackend.asKube()
+		kubeIng.Spec.Backend = &backend
 	}
 	kubeIng.Annotations = ing.annotations
 	kubeIng.Labels = ing.labels
+	ing.kube.stampProvenance(&kubeIng.ObjectMeta)
+
 	if len(ing.tlsSecret) > 0 {
-		kubeIng.Spec.TLS = []v1beta1.IngressTLS{{Hosts: []string{ing.host}, SecretName: ing.tlsSecret}}
+		tlsHosts := []string{ing.host}
+		if len(ing.host) == 0 {
+			tlsHosts = nil
+			for _, host := range hosts {
+				tlsHosts = append(tlsHosts, host.host)
+			}
+		}
+		kubeIng.Spec.TLS = append(kubeIng.Spec.TLS, v1beta1.IngressTLS{Hosts: tlsHosts, SecretName: ing.tlsSecret})
+	}
+	for _, tls := range ing.tls {
+		kubeIng.Spec.TLS = append(kubeIng.Spec.TLS, v1beta1.IngressTLS{Hosts: tls.hosts, SecretName: tls.secret})
 	}
 	return
 }
 
-func (ing IngressBuilder) Push() (kubeIng *v1beta1.Ingress, err error) {
-	kubeIng = ing.AsKube()
-	err = PushIngress(kubeIng, ing.kube.iface)
-	return
+// build returns the ingress as it is pushed, unstructured when it has path types.
+func (ing IngressBuilder) build() (runtime.Object, error) {
+	if ing.hasPathTypes() {
+		return ing.unstructuredIngress(ing.AsKube())
+	}
+	return ing.AsKube(), nil
+}
+
+// client pushes the ingress through the typed client, or the dynamic one when it has path types.
+func (ing IngressBuilder) client() (objectClient, error) {
+	if ing.hasPathTypes() {
+		return ing.unstructuredIngressClient()
+	}
+	return ingressClient(ing.namespace, ing.kube.iface), nil
 }
 
-func PushIngress(kubeIng *v1beta1.Ingress, iface kubernetes.Interface) (err error) {
-	ingresses := iface.ExtensionsV1beta1().Ingresses(kubeIng.Namespace)
-	foundIng, err := ingresses.Get(kubeIng.Name, meta_v1.GetOptions{})
-	var f func(*v1beta1.Ingress) (*v1beta1.Ingress, error)
-	if kube_errors.IsNotFound(err) {
-		f = ingresses.Create
-	} else if err != nil {
+func (ing IngressBuilder) Render(w io.Writer, format Format) error {
+	obj, err := ing.build()
+	if err != nil {
+		return err
+	}
+	return Render(w, format, obj)
+}
+
+func (ing IngressBuilder) Diff() (diff ObjectDiff, err error) {
+	obj, err := ing.build()
+	if err != nil {
 		return
-	} else {
-		foundIng.Spec = kubeIng.Spec
-		kubeIng = foundIng
-		f = ingresses.Update
 	}
-	_, err = f(kubeIng)
+	client, err := ing.client()
 	if err != nil {
-		err = errors.Wrapf(err, "failed to create ingress")
+		return
+	}
+	return client.diff(obj)
+}
+
+// Push creates or updates the ingress. The returned ingress lacks the path types even when they were
+// pushed.
+func (ing IngressBuilder) Push() (kubeIng *v1beta1.Ingress, result PushResult, err error) {
+	kubeIng = ing.AsKube()
+	if ing.preflight {
+		if err = CheckIngress(kubeIng, ing.kube.iface); err != nil {
+			return
+		}
+	}
+	obj, err := ing.build()
+	if err != nil {
+		return
+	}
+	client, err := ing.client()
+	if err != nil {
+		return
+	}
+	result, err = client.push(obj, ing.kube.dryRun)
+	switch persisted := result.Object.(type) {
+	case *v1beta1.Ingress:
+		kubeIng = persisted
+	case *unstructured.Unstructured:
+		if typed, typedErr := typedIngress(persisted); typedErr == nil {
+			kubeIng = typed
+		}
 	}
 	return
 }
+
+func PushIngress(kubeIng *v1beta1.Ingress, iface kubernetes.Interface) (result PushResult, err error) {
+	return ingressClient(kubeIng.Namespace, iface).push(kubeIng, dryRunNone)
+}
+
+func ingressClient(namespace string, iface kubernetes.Interface) objectClient {
+	ingresses := iface.ExtensionsV1beta1().Ingresses(namespace)
+	return objectClient{
+		kind:      "ingress",
+		resource:  "ingresses",
+		namespace: namespace,
+		rest:      iface.ExtensionsV1beta1().RESTClient(),
+		newObject: func() runtime.Object { return new(v1beta1.Ingress) },
+		get: func(name string) (runtime.Object, error) {
+			return ingresses.Get(name, meta_v1.GetOptions{})
+		},
+		create: func(obj runtime.Object) (runtime.Object, error) {
+			return ingresses.Create(obj.(*v1beta1.Ingress))
+		},
+		update: func(obj runtime.Object) (runtime.Object, error) {
+			return ingresses.Update(obj.(*v1beta1.Ingress))
+		},
+		delete: ingresses.Delete,
+		prepare: func(live, desired runtime.Object) (runtime.Object, error) {
+			foundIng := *live.(*v1beta1.Ingress)
+			foundIng.Labels = desired.(*v1beta1.Ingress).Labels
+			foundIng.Annotations = desired.(*v1beta1.Ingress).Annotations
+			foundIng.Spec = desired.(*v1beta1.Ingress).Spec
+			return &foundIng, nil
+		},
+		describe: describeIngress,
+	}
+}
+
+// describeIngress names an ingress along with its hosts, which are what people know it by.
+func describeIngress(obj runtime.Object) string {
+	kubeIng := obj.(*v1beta1.Ingress)
+	var hosts []string
+	for _, rule := range kubeIng.Spec.Rules {
+		if len(rule.Host) > 0 {
+			hosts = append(hosts, rule.Host)
+		}
+	}
+	if len(hosts) == 0 {
+		return kubeIng.Name
+	}
+	return fmt.Sprintf("%s (%s)", kubeIng.Name, strings.Join(hosts, ", "))
+}
@@ -0,0 +1,134 @@
+package kube_builders
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	ingressClassAnnotation = "kubernetes.io/ingress.class"
+	tlsAcmeAnnotation      = "kubernetes.io/tls-acme"
+
+	nginxPrefix          = "nginx.ingress.kubernetes.io/"
+	traefikPrefix        = "traefik.ingress.kubernetes.io/"
+	traefikGenericPrefix = "ingress.kubernetes.io/"
+)
+
+// IngressClass picks the controller which serves the ingress when a cluster runs several. This API
+// version only supports the class through an annotation.
+func (ing IngressBuilder) IngressClass(name string) IngressBuilder {
+	return ing.Annotation(ingressClassAnnotation, name)
+}
+
+// TLSAcme asks kube-lego or cert-manager to provision the certificates of the TLS secrets.
+func (ing IngressBuilder) TLSAcme() IngressBuilder {
+	return ing.Annotation(tlsAcmeAnnotation, "true")
+}
+
+// Nginx sets annotations understood by the nginx ingress controller.
+func (ing IngressBuilder) Nginx(builder func(NginxAnnotations) NginxAnnotations) IngressBuilder {
+	return ing.withAnnotations(builder(NginxAnnotations{}).annotations)
+}
+
+// Traefik sets annotations understood by traefik.
+func (ing IngressBuilder) Traefik(builder func(TraefikAnnotations) TraefikAnnotations) IngressBuilder {
+	return ing.withAnnotations(builder(TraefikAnnotations{}).annotations)
+}
+
+func (ing IngressBuilder) withAnnotations(annotations map[string]string) IngressBuilder {
+	for key, value := range annotations {
+		ing = ing.Annotation(key, value)
+	}
+	return ing
+}
+
+type NginxAnnotations struct {
+	annotations map[string]string
+}
+
+func (nginx NginxAnnotations) set(name string, value interface{}) NginxAnnotations {
+	setAtMap(&nginx.annotations, nginxPrefix+name, value)
+	return nginx
+}
+
+// RewriteTarget replaces the matched path before the request is sent to the service.
+func (nginx NginxAnnotations) RewriteTarget(target string) NginxAnnotations {
+	return nginx.set("rewrite-target", target)
+}
+
+// ProxyBodySize is the largest request body accepted, such as "8m", or "0" for no limit.
+func (nginx NginxAnnotations) ProxyBodySize(size string) NginxAnnotations {
+	return nginx.set("proxy-body-size", size)
+}
+
+func (nginx NginxAnnotations) SSLRedirect(redirect bool) NginxAnnotations {
+	return nginx.set("ssl-redirect", redirect)
+}
+
+// BasicAuth requires credentials from an htpasswd file stored under the auth key of secret.
+func (nginx NginxAnnotations) BasicAuth(secret, realm string) NginxAnnotations {
+	return nginx.set("auth-type", "basic").set("auth-secret", secret).set("auth-realm", realm)
+}
+
+// RateLimit limits the requests per second and concurrent connections of each client IP. Zero leaves a
+// limit unset.
+func (nginx NginxAnnotations) RateLimit(requestsPerSecond, connections int) NginxAnnotations {
+	if requestsPerSecond > 0 {
+		nginx = nginx.set("limit-rps", requestsPerSecond)
+	}
+	if connections > 0 {
+		nginx = nginx.set("limit-connections", connections)
+	}
+	return nginx
+}
+
+// CORS allows cross origin requests from origin, "*" allowing any.
+func (nginx NginxAnnotations) CORS(origin string) NginxAnnotations {
+	return nginx.set("enable-cors", true).set("cors-allow-origin", origin)
+}
+
+type TraefikAnnotations struct {
+	annotations map[string]string
+}
+
+func (traefik TraefikAnnotations) set(name string, value interface{}) TraefikAnnotations {
+	setAtMap(&traefik.annotations, name, value)
+	return traefik
+}
+
+func (traefik TraefikAnnotations) RewriteTarget(target string) TraefikAnnotations {
+	return traefik.set(traefikPrefix+"rewrite-target", target)
+}
+
+// MaxRequestBodyBytes is the largest request body accepted, which makes traefik buffer requests.
+func (traefik TraefikAnnotations) MaxRequestBodyBytes(size int64) TraefikAnnotations {
+	return traefik.set(traefikPrefix+"buffering", fmt.Sprintf("maxrequestbodybytes: %d", size))
+}
+
+func (traefik TraefikAnnotations) SSLRedirect(redirect bool) TraefikAnnotations {
+	return traefik.set(traefikGenericPrefix+"ssl-redirect", redirect)
+}
+
+// BasicAuth requires credentials from an htpasswd file stored under the auth key of secret. Traefik has
+// no realm setting.
+func (traefik TraefikAnnotations) BasicAuth(secret string) TraefikAnnotations {
+	return traefik.set(traefikGenericPrefix+"auth-type", "basic").set(traefikGenericPrefix+"auth-secret", secret)
+}
+
+// RateLimit limits the average requests per second of each client IP, allowing bursts of up to burst
+// requests.
+func (traefik TraefikAnnotations) RateLimit(average, burst int) TraefikAnnotations {
+	return traefik.set(traefikPrefix+"rate-limit", strings.Join([]string{
+		"extractorfunc: client.ip",
+		"rateset:",
+		"  default:",
+		"    period: 1s",
+		fmt.Sprintf("    average: %d", average),
+		fmt.Sprintf("    burst: %d", burst),
+	}, "\n"))
+}
+
+// CORS allows cross origin requests from origin, "*" allowing any.
+func (traefik TraefikAnnotations) CORS(origin string) TraefikAnnotations {
+	return traefik.set(traefikGenericPrefix+"custom-response-headers", "Access-Control-Allow-Origin:"+origin)
+}
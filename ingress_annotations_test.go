@@ -0,0 +1,53 @@
+package kube_builders_test
+
+import (
+	. "github.com/Twister915/kube_builders"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var _ = Describe("Ingress Annotations", func() {
+	const (
+		name      = "test-ing"
+		namespace = "test"
+		domain    = "test.spectonic.com"
+	)
+
+	var kubeTarget *KubeTarget
+
+	BeforeEach(func() {
+		kubeTarget = NewKubeTarget(fake.NewSimpleClientset())
+	})
+
+	It("sets nginx annotations", func() {
+		annotations := kubeTarget.Ingress(name, namespace, domain).IngressClass("nginx").TLSAcme().Nginx(func(nginx NginxAnnotations) NginxAnnotations {
+			return nginx.RewriteTarget("/").ProxyBodySize("8m").SSLRedirect(false).BasicAuth("users", "Staff").RateLimit(10, 0).CORS("*")
+		}).AsKube().Annotations
+
+		Expect(annotations).To(HaveKeyWithValue("kubernetes.io/ingress.class", "nginx"))
+		Expect(annotations).To(HaveKeyWithValue("kubernetes.io/tls-acme", "true"))
+		Expect(annotations).To(HaveKeyWithValue("nginx.ingress.kubernetes.io/rewrite-target", "/"))
+		Expect(annotations).To(HaveKeyWithValue("nginx.ingress.kubernetes.io/proxy-body-size", "8m"))
+		Expect(annotations).To(HaveKeyWithValue("nginx.ingress.kubernetes.io/ssl-redirect", "false"))
+		Expect(annotations).To(HaveKeyWithValue("nginx.ingress.kubernetes.io/auth-type", "basic"))
+		Expect(annotations).To(HaveKeyWithValue("nginx.ingress.kubernetes.io/auth-secret", "users"))
+		Expect(annotations).To(HaveKeyWithValue("nginx.ingress.kubernetes.io/limit-rps", "10"))
+		Expect(annotations).ToNot(HaveKey("nginx.ingress.kubernetes.io/limit-connections"))
+		Expect(annotations).To(HaveKeyWithValue("nginx.ingress.kubernetes.io/enable-cors", "true"))
+	})
+
+	It("sets traefik annotations", func() {
+		annotations := kubeTarget.Ingress(name, namespace, domain).IngressClass("traefik").Traefik(func(traefik TraefikAnnotations) TraefikAnnotations {
+			return traefik.RewriteTarget("/").SSLRedirect(true).BasicAuth("users").RateLimit(100, 50).MaxRequestBodyBytes(1 << 20)
+		}).AsKube().Annotations
+
+		Expect(annotations).To(HaveKeyWithValue("kubernetes.io/ingress.class", "traefik"))
+		Expect(annotations).To(HaveKeyWithValue("traefik.ingress.kubernetes.io/rewrite-target", "/"))
+		Expect(annotations).To(HaveKeyWithValue("ingress.kubernetes.io/ssl-redirect", "true"))
+		Expect(annotations).To(HaveKeyWithValue("ingress.kubernetes.io/auth-secret", "users"))
+		Expect(annotations).To(HaveKeyWithValue("traefik.ingress.kubernetes.io/buffering", "maxrequestbodybytes: 1048576"))
+		Expect(annotations["traefik.ingress.kubernetes.io/rate-limit"]).To(ContainSubstring("average: 100"))
+	})
+})
@@ -0,0 +1,119 @@
+package kube_builders
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	kube_errors "k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/pkg/apis/extensions/v1beta1"
+)
+
+// PreflightError lists every problem found with the objects an ingress references.
+type PreflightError struct {
+	Ingress  string
+	Problems []string
+}
+
+func (err *PreflightError) Error() string {
+	return fmt.Sprintf("ingress %s failed preflight: %s", err.Ingress, strings.Join(err.Problems, "; "))
+}
+
+// Preflight makes Push check that every service an ingress routes to exists and exposes the port used,
+// and that TLS secrets exist with type kubernetes.io/tls, before anything is pushed. Secrets may be
+// missing when TLSAcme is set, as they are created once the certificate is issued.
+func (ing IngressBuilder) Preflight() IngressBuilder {
+	ing.preflight = true
+	return ing
+}
+
+// CheckIngress runs the preflight checks on an ingress. Problems are returned as a *PreflightError,
+// other errors come from talking to the cluster.
+func CheckIngress(kubeIng *v1beta1.Ingress, iface kubernetes.Interface) (err error) {
+	var problems []string
+
+	var backends []v1beta1.IngressBackend
+	if kubeIng.Spec.Backend != nil {
+		backends = append(backends, *kubeIng.Spec.Backend)
+	}
+	for _, rule := range kubeIng.Spec.Rules {
+		if rule.HTTP == nil {
+			continue
+		}
+		for _, path := range rule.HTTP.Paths {
+			backends = append(backends, path.Backend)
+		}
+	}
+
+	services := make(map[string]*v1.Service)
+	checked := make(map[v1beta1.IngressBackend]bool)
+	for _, backend := range backends {
+		if checked[backend] {
+			continue
+		}
+		checked[backend] = true
+
+		svc, cached := services[backend.ServiceName]
+		if !cached {
+			svc, err = iface.CoreV1().Services(kubeIng.Namespace).Get(backend.ServiceName, meta_v1.GetOptions{})
+			if kube_errors.IsNotFound(err) {
+				svc, err = nil, nil
+			} else if err != nil {
+				return errors.Wrapf(err, "failed to get service %s", backend.ServiceName)
+			}
+			services[backend.ServiceName] = svc
+		}
+		if svc == nil {
+			problems = append(problems, fmt.Sprintf("service %s does not exist", backend.ServiceName))
+		} else if !exposesPort(svc, backend) {
+			problems = append(problems, fmt.Sprintf("service %s has no port %s", backend.ServiceName, backend.ServicePort.String()))
+		}
+	}
+
+	acme := kubeIng.Annotations[tlsAcmeAnnotation] == "true"
+	for _, tls := range kubeIng.Spec.TLS {
+		if len(tls.SecretName) == 0 {
+			continue
+		}
+		var secret *v1.Secret
+		secret, err = iface.CoreV1().Secrets(kubeIng.Namespace).Get(tls.SecretName, meta_v1.GetOptions{})
+		if kube_errors.IsNotFound(err) {
+			err = nil
+			if !acme {
+				problems = append(problems, fmt.Sprintf("TLS secret %s does not exist", tls.SecretName))
+			}
+			continue
+		} else if err != nil {
+			return errors.Wrapf(err, "failed to get secret %s", tls.SecretName)
+		}
+		if secret.Type != v1.SecretTypeTLS {
+			problems = append(problems, fmt.Sprintf("TLS secret %s has type %q instead of %q", tls.SecretName, secret.Type, v1.SecretTypeTLS))
+		}
+	}
+
+	if len(problems) > 0 {
+		err = &PreflightError{Ingress: kubeIng.Name, Problems: problems}
+	}
+	return
+}
+
+// exposesPort checks the port of a backend against the service, by number or by name.
+func exposesPort(svc *v1.Service, backend v1beta1.IngressBackend) bool {
+	for _, port := range svc.Spec.Ports {
+		switch backend.ServicePort.Type {
+		case intstr.Int:
+			if port.Port == backend.ServicePort.IntVal {
+				return true
+			}
+		case intstr.String:
+			if port.Name == backend.ServicePort.StrVal {
+				return true
+			}
+		}
+	}
+	return false
+}
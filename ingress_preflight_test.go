@@ -0,0 +1,79 @@
+package kube_builders_test
+
+import (
+	. "github.com/Twister915/kube_builders"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+var _ = Describe("Ingress Preflight", func() {
+	const (
+		name      = "test-ing"
+		namespace = "test"
+		domain    = "test.spectonic.com"
+	)
+
+	var (
+		fakeKubernetes kubernetes.Interface
+		kubeTarget     *KubeTarget
+	)
+
+	createSecret := func(secretName string, secretType v1.SecretType) {
+		secret := &v1.Secret{Type: secretType}
+		secret.Name = secretName
+		secret.Namespace = namespace
+		_, err := fakeKubernetes.CoreV1().Secrets(namespace).Create(secret)
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	BeforeEach(func() {
+		fakeKubernetes = fake.NewSimpleClientset()
+		kubeTarget = NewKubeTarget(fakeKubernetes)
+
+		_, _, err := kubeTarget.Service("web", namespace).Selector("app", "web").PortByNumber("http", 8080, 80).Push()
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("pushes ingresses whose references exist", func() {
+		createSecret("cert", v1.SecretTypeTLS)
+		_, _, err := kubeTarget.Ingress(name, namespace, domain).Path("/", "web", 80).TLS("cert").Preflight().Push()
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("reports every problem at once without pushing", func() {
+		createSecret("opaque", v1.SecretTypeOpaque)
+		_, _, err := kubeTarget.Ingress(name, namespace, domain).
+			Path("/", "web", 8080).
+			Path("/api", "api", 80).
+			DefaultBackend("web", 80).
+			TLSHosts("opaque", domain).
+			TLSHosts("missing", "other.spectonic.com").
+			Preflight().
+			Push()
+
+		Expect(err).To(BeAssignableToTypeOf(&PreflightError{}))
+		Expect(err.(*PreflightError).Problems).To(ConsistOf(
+			"service web has no port 8080",
+			"service api does not exist",
+			`TLS secret opaque has type "Opaque" instead of "kubernetes.io/tls"`,
+			"TLS secret missing does not exist",
+		))
+		_, err = fakeKubernetes.ExtensionsV1beta1().Ingresses(namespace).Get(name, meta_v1.GetOptions{})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("lets acme create missing secrets", func() {
+		_, _, err := kubeTarget.Ingress(name, namespace, domain).Path("/", "web", 80).TLS("cert").TLSAcme().Preflight().Push()
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("is opt-in", func() {
+		_, _, err := kubeTarget.Ingress(name, namespace, domain).Path("/", "api", 80).Push()
+		Expect(err).ToNot(HaveOccurred())
+	})
+})
@@ -1,12 +1,18 @@
 package kube_builders_test
 
 import (
+	"bytes"
+	"errors"
+
 	. "github.com/Twister915/kube_builders"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/fake"
+	core "k8s.io/client-go/testing"
 )
 
 var _ = Describe("Ingress Builder", func() {
@@ -49,9 +55,131 @@ var _ = Describe("Ingress Builder", func() {
 		Expect(pathFromGen.Backend.ServicePort.IntValue()).To(Equal(servicePort))
 	})
 
+	It("keeps paths in the order they were added", func() {
+		ing := kubeTarget.Ingress(name, namespace, domain).Path("/z", serviceName, servicePort).Path("/a", serviceName, servicePort)
+		rules := ing.AsKube().Spec.Rules
+		Expect(rules[0].HTTP.Paths[0].Path).To(Equal("/z"))
+		Expect(rules[0].HTTP.Paths[1].Path).To(Equal("/a"))
+
+		rules = ing.Sorted().AsKube().Spec.Rules
+		Expect(rules[0].HTTP.Paths[0].Path).To(Equal("/a"))
+	})
+
+	It("groups paths under one rule per host", func() {
+		ingress := kubeTarget.Ingress(name, namespace, domain).
+			Path("/", serviceName, servicePort).
+			Path("/api", "api", 8080).
+			Host("admin.spectonic.com", func(host IngressHostBuilder) IngressHostBuilder {
+				return host.Path("/", "admin", 80).Path("/metrics", "metrics", 9090)
+			}).
+			DefaultBackend("fallback", 80).
+			AsKube()
+
+		Expect(ingress.Spec.Rules).To(HaveLen(2))
+		Expect(ingress.Spec.Rules[0].Host).To(Equal(domain))
+		Expect(ingress.Spec.Rules[0].HTTP.Paths).To(HaveLen(2))
+		Expect(ingress.Spec.Rules[1].Host).To(Equal("admin.spectonic.com"))
+		Expect(ingress.Spec.Rules[1].HTTP.Paths[1].Backend.ServiceName).To(Equal("metrics"))
+		Expect(ingress.Spec.Backend.ServiceName).To(Equal("fallback"))
+	})
+
+	It("generates a TLS entry per secret", func() {
+		ingress := kubeTarget.Ingress(name, namespace, "").
+			Host("a.spectonic.com", func(host IngressHostBuilder) IngressHostBuilder { return host.Path(path, serviceName, servicePort) }).
+			Host("b.spectonic.com", func(host IngressHostBuilder) IngressHostBuilder { return host.Path(path, serviceName, servicePort) }).
+			Host("c.example.com", func(host IngressHostBuilder) IngressHostBuilder { return host.Path(path, serviceName, servicePort) }).
+			TLSHosts("spectonic-tls", "a.spectonic.com", "b.spectonic.com").
+			TLSHosts("example-tls", "c.example.com").
+			AsKube()
+
+		Expect(ingress.Spec.TLS).To(HaveLen(2))
+		Expect(ingress.Spec.TLS[0].SecretName).To(Equal("spectonic-tls"))
+		Expect(ingress.Spec.TLS[0].Hosts).To(Equal([]string{"a.spectonic.com", "b.spectonic.com"}))
+		Expect(ingress.Spec.TLS[1].Hosts).To(Equal([]string{"c.example.com"}))
+
+		By("covering the domain of the ingress with TLS")
+		tls := kubeTarget.Ingress(name, namespace, domain).Path(path, serviceName, servicePort).TLS("cert").AsKube().Spec.TLS
+		Expect(tls).To(HaveLen(1))
+		Expect(tls[0].Hosts).To(Equal([]string{domain}))
+	})
+
+	It("sets path types", func() {
+		ing := kubeTarget.Ingress(name, namespace, domain).
+			Path("/", serviceName, servicePort).
+			Path("/healthz", serviceName, servicePort).
+			PathType("/healthz", PathTypeExact)
+
+		var rendered bytes.Buffer
+		Expect(ing.Render(&rendered, FormatYAML)).To(Succeed())
+		Expect(rendered.String()).To(ContainSubstring("pathType: Exact"))
+		Expect(rendered.String()).To(ContainSubstring("pathType: ImplementationSpecific"))
+
+		By("pushing them through the dynamic client")
+		_, _, err := ing.Push()
+		Expect(err).To(MatchError(ContainSubstring("no dynamic client")))
+
+		Expect(func() { ing.PathType("/missing", PathTypePrefix) }).To(Panic())
+	})
+
 	It("pushes to kubernetes", func() {
-		ingress, err := kubeTarget.Ingress(name, namespace, domain).Path(path, serviceName, servicePort).Push()
+		ingress, _, err := kubeTarget.Ingress(name, namespace, domain).Path(path, serviceName, servicePort).Push()
 		Expect(err).ToNot(HaveOccurred())
 		Expect(ingress.Name).To(Equal(name))
 	})
+
+	It("applies metadata changes on update", func() {
+		_, _, err := kubeTarget.Ingress(name, namespace, domain).Path(path, serviceName, servicePort).Push()
+		Expect(err).ToNot(HaveOccurred())
+
+		_, result, err := kubeTarget.Ingress(name, namespace, domain).Path(path, serviceName, servicePort).TLSAcme().Label("team", "web").Push()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Operation).To(Equal(OperationUpdated))
+
+		live, err := fakeKubernetes.ExtensionsV1beta1().Ingresses(namespace).Get(name, meta_v1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(live.Annotations).To(HaveKeyWithValue("kubernetes.io/tls-acme", "true"))
+		Expect(live.Labels).To(HaveKeyWithValue("team", "web"))
+	})
+
+	It("removes labels and annotations the builder no longer sets", func() {
+		_, _, err := kubeTarget.Ingress(name, namespace, domain).Path(path, serviceName, servicePort).TLSAcme().Label("team", "web").Push()
+		Expect(err).ToNot(HaveOccurred())
+
+		_, result, err := kubeTarget.Ingress(name, namespace, domain).Path(path, serviceName, servicePort).Push()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Operation).To(Equal(OperationUpdated))
+
+		live, err := fakeKubernetes.ExtensionsV1beta1().Ingresses(namespace).Get(name, meta_v1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(live.Annotations).ToNot(HaveKey("kubernetes.io/tls-acme"))
+		Expect(live.Labels).ToNot(HaveKey("team"))
+	})
+
+	It("updates when a TLS entry is removed", func() {
+		_, _, err := kubeTarget.Ingress(name, namespace, domain).Path(path, serviceName, servicePort).TLS("cert").Push()
+		Expect(err).ToNot(HaveOccurred())
+
+		ingress, result, err := kubeTarget.Ingress(name, namespace, domain).Path(path, serviceName, servicePort).Push()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Operation).To(Equal(OperationUpdated))
+		Expect(ingress.Spec.TLS).To(BeEmpty())
+	})
+
+	It("says which request failed and for which host", func() {
+		failing := fake.NewSimpleClientset()
+		failingTarget := NewKubeTarget(failing)
+		ing := failingTarget.Ingress(name, namespace, domain).Path(path, serviceName, servicePort)
+
+		failing.PrependReactor("create", "ingresses", func(core.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.New("quota exceeded")
+		})
+		_, _, err := ing.Push()
+		Expect(err).To(MatchError("failed to create ingress test-ing (test.spectonic.com): quota exceeded"))
+
+		failing.PrependReactor("get", "ingresses", func(core.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.New("connection refused")
+		})
+		_, _, err = ing.Push()
+		Expect(err).To(MatchError("failed to get current ingress test-ing (test.spectonic.com): connection refused"))
+	})
 })
@@ -0,0 +1,83 @@
+package kube_builders
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/pkg/apis/extensions/v1beta1"
+)
+
+// Ingresses with path types, which our typed client doesn't have, are pushed as unstructured objects
+// through the dynamic client. Servers since kubernetes 1.18 accept path types on extensions/v1beta1.
+
+var ingressKind = schema.GroupVersionKind{Group: "extensions", Version: "v1beta1", Kind: "Ingress"}
+
+// hasPathTypes tells whether a path type was set on any path of the ingress.
+func (ing IngressBuilder) hasPathTypes() bool {
+	for _, host := range ing.hosts {
+		for _, path := range host.paths {
+			if len(path.pathType) > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// unstructuredIngress converts a typed ingress into an unstructured one with the path types of the
+// builder added. Paths without one are given ImplementationSpecific, as the server would.
+func (ing IngressBuilder) unstructuredIngress(kubeIng *v1beta1.Ingress) (obj *unstructured.Unstructured, err error) {
+	data, err := json.Marshal(kubeIng)
+	if err != nil {
+		return nil, errors.Wrapf(err, "encoding ingress %s", kubeIng.Name)
+	}
+	obj = new(unstructured.Unstructured)
+	if err = obj.UnmarshalJSON(data); err != nil {
+		return nil, errors.Wrapf(err, "decoding ingress %s", kubeIng.Name)
+	}
+
+	spec, _ := obj.Object["spec"].(map[string]interface{})
+	rules, _ := spec["rules"].([]interface{})
+	for i, host := range ing.sortedHosts() {
+		http, _ := rules[i].(map[string]interface{})["http"].(map[string]interface{})
+		paths, _ := http["paths"].([]interface{})
+		for j, path := range host.paths {
+			pathType := path.pathType
+			if len(pathType) == 0 {
+				pathType = PathTypeImplementationSpecific
+			}
+			paths[j].(map[string]interface{})["pathType"] = pathType
+		}
+	}
+	return
+}
+
+// typedIngress converts an unstructured ingress into a typed one, dropping the path types.
+func typedIngress(obj runtime.Object) (kubeIng *v1beta1.Ingress, err error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return
+	}
+	kubeIng = new(v1beta1.Ingress)
+	err = json.Unmarshal(data, kubeIng)
+	return
+}
+
+// unstructuredIngressClient pushes ingresses through the dynamic client.
+func (ing IngressBuilder) unstructuredIngressClient() (client objectClient, err error) {
+	client, err = ing.kube.dynamicClient(ingressKind, "ingress", "ingresses", ing.namespace)
+	if err != nil {
+		return
+	}
+	client.describe = func(obj runtime.Object) string {
+		kubeIng, err := typedIngress(obj)
+		if err != nil {
+			return obj.(*unstructured.Unstructured).GetName()
+		}
+		return describeIngress(kubeIng)
+	}
+	return
+}
@@ -1,6 +1,7 @@
 package kube_builders
 
 import (
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	kube "k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
@@ -20,6 +21,7 @@ func NewKubernetes(ca, cert, key []byte, username, password, address string) (t
 		return
 	}
 	t = NewKubeTarget(k)
+	t.dynamic = dynamic.NewDynamicClientPool(cfg)
 	return
 }
 
@@ -28,6 +30,9 @@ func NewKubeTarget(iface kubernetes.Interface) *KubeTarget {
 }
 
 type KubeTarget struct {
-	iface kubernetes.Interface
+	iface      kubernetes.Interface
+	dryRun     dryRunMode
+	provenance *Provenance
+	dynamic    dynamic.ClientPool
 }
 
@@ -1,9 +1,12 @@
 package kube_builders
 
 import (
+	"io"
+
 	"github.com/pkg/errors"
 	kube_errors "k8s.io/apimachinery/pkg/api/errors"
 	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/pkg/api/v1"
 )
@@ -16,7 +19,7 @@ func (kube *KubeTarget) EnsureNamespaceExists(name string, b func(builder Namesp
 		if b != nil {
 			builder = b(builder)
 		}
-		_, err = builder.Push()
+		_, _, err = builder.Push()
 	} else if err != nil {
 		err = errors.Wrapf(err, "error finding namespace %s", name)
 	}
@@ -51,22 +54,52 @@ func (ns NamespaceBuilder) Annotation(annotation string, value interface{}) Name
 
 func (ns NamespaceBuilder) AsKube() (kubeNs *v1.Namespace) {
 	kubeNs = new(v1.Namespace)
+	kubeNs.TypeMeta = meta_v1.TypeMeta{Kind: "Namespace", APIVersion: v1.SchemeGroupVersion.String()}
 	kubeNs.Name = ns.name
 	kubeNs.Labels = ns.labels
 	kubeNs.Annotations = ns.annotations
+	ns.kube.stampProvenance(&kubeNs.ObjectMeta)
 	return
 }
 
-func (ns NamespaceBuilder) Push() (kubeNs *v1.Namespace, err error) {
+func (ns NamespaceBuilder) Render(w io.Writer, format Format) error {
+	return Render(w, format, ns.AsKube())
+}
+
+func (ns NamespaceBuilder) Diff() (ObjectDiff, error) {
+	return ns.kube.diff(ns.AsKube())
+}
+
+// Push creates the namespace. Namespaces are never updated, so pushing one which already exists fails
+// with an already exists error, like it always has; EnsureNamespaceExists skips existing namespaces.
+func (ns NamespaceBuilder) Push() (kubeNs *v1.Namespace, result PushResult, err error) {
 	kubeNs = ns.AsKube()
-	err = PushNamespace(kubeNs, ns.kube.iface)
+	result, err = ns.kube.push(kubeNs)
+	if persisted, ok := result.Object.(*v1.Namespace); ok {
+		kubeNs = persisted
+	}
 	return
 }
 
-func PushNamespace(kubeNs *v1.Namespace, iface kubernetes.Interface) (err error) {
-	_, err = iface.CoreV1().Namespaces().Create(kubeNs)
-	if err != nil {
-		err = errors.Wrapf(err, "creating namespace %s", kubeNs.Name)
+// PushNamespace creates kubeNs, failing when it already exists.
+func PushNamespace(kubeNs *v1.Namespace, iface kubernetes.Interface) (result PushResult, err error) {
+	return namespaceClient(iface).push(kubeNs, dryRunNone)
+}
+
+func namespaceClient(iface kubernetes.Interface) objectClient {
+	namespaces := iface.CoreV1().Namespaces()
+	return objectClient{
+		kind:      "namespace",
+		resource:  "namespaces",
+		rest:      iface.CoreV1().RESTClient(),
+		newObject: func() runtime.Object { return new(v1.Namespace) },
+		get: func(name string) (runtime.Object, error) {
+			return namespaces.Get(name, meta_v1.GetOptions{})
+		},
+		create: func(obj runtime.Object) (runtime.Object, error) {
+			return namespaces.Create(obj.(*v1.Namespace))
+		},
+		delete:     namespaces.Delete,
+		createOnly: true,
 	}
-	return
 }
@@ -5,6 +5,8 @@ import (
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	kube_errors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/fake"
 )
@@ -35,12 +37,20 @@ var _ = Describe("Namespace", func() {
 	})
 
 	It("pushes to kubernetes", func() {
-		ns, err := kubeTarget.CreateNamespace(namespace).Annotation(annotation, annotationValue).Push()
+		ns, _, err := kubeTarget.CreateNamespace(namespace).Annotation(annotation, annotationValue).Push()
 		Expect(err).ToNot(HaveOccurred())
 		Expect(ns.Name).To(Equal(namespace))
 		Expect(ns.Annotations).To(HaveKeyWithValue(annotation, annotationValue))
 	})
 
+	It("does not update a namespace which already exists", func() {
+		_, _, err := kubeTarget.CreateNamespace(namespace).Push()
+		Expect(err).ToNot(HaveOccurred())
+
+		_, _, err = kubeTarget.CreateNamespace(namespace).Annotation(annotation, annotationValue).Push()
+		Expect(kube_errors.IsAlreadyExists(errors.Cause(err))).To(BeTrue())
+	})
+
 	It("creates a namespace when it does not exist", func() {
 		By("pushing first time")
 		var called bool
@@ -1,6 +1,11 @@
 package kube_builders
 
-import "k8s.io/client-go/pkg/api/v1"
+import (
+	"io"
+
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/pkg/api/v1"
+)
 
 type PodBuilder struct {
 	kube *KubeTarget
@@ -82,6 +87,7 @@ func (pod PodBuilder) HostNetwork(hostNetwork bool) PodBuilder {
 
 func (pod PodBuilder) AsKube() (kubePod *v1.Pod) {
 	kubePod = new(v1.Pod)
+	kubePod.TypeMeta = meta_v1.TypeMeta{Kind: "Pod", APIVersion: v1.SchemeGroupVersion.String()}
 	kubePod.Name = pod.name
 	kubePod.Namespace = pod.namespace
 	kubePod.Annotations = pod.annotations
@@ -96,3 +102,7 @@ func (pod PodBuilder) AsKube() (kubePod *v1.Pod) {
 	kubePod.Spec.HostNetwork = pod.hostNetwork
 	return
 }
+
+func (pod PodBuilder) Render(w io.Writer, format Format) error {
+	return Render(w, format, pod.AsKube())
+}
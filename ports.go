@@ -0,0 +1,67 @@
+package kube_builders
+
+import (
+	"github.com/pkg/errors"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+// portKey identifies a port the way kubernetes does, an empty protocol being TCP.
+type portKey struct {
+	port     int32
+	protocol v1.Protocol
+}
+
+func newPortKey(port int32, protocol v1.Protocol) portKey {
+	if len(protocol) == 0 {
+		protocol = v1.ProtocolTCP
+	}
+	return portKey{port: port, protocol: protocol}
+}
+
+// validatePodPorts rejects containers of one pod listening on the same port and protocol, as they share
+// a network namespace, and host ports used twice, which would never be scheduled.
+func validatePodPorts(spec v1.PodSpec) error {
+	containerPorts, hostPorts := make(map[portKey]string), make(map[portKey]string)
+	for _, container := range spec.Containers {
+		for _, port := range container.Ports {
+			key := newPortKey(port.ContainerPort, port.Protocol)
+			if other, taken := containerPorts[key]; taken {
+				return errors.Errorf("containers %s and %s both use port %d/%s", other, container.Name, key.port, key.protocol)
+			}
+			containerPorts[key] = container.Name
+
+			if port.HostPort == 0 {
+				continue
+			}
+			key = newPortKey(port.HostPort, port.Protocol)
+			if other, taken := hostPorts[key]; taken {
+				return errors.Errorf("containers %s and %s both use host port %d/%s", other, container.Name, key.port, key.protocol)
+			}
+			hostPorts[key] = container.Name
+		}
+	}
+	return nil
+}
+
+// validateServicePorts rejects two ports of a service on the same port and protocol, or on the same node
+// port.
+func validateServicePorts(ports []v1.ServicePort) error {
+	servicePorts, nodePorts := make(map[portKey]string), make(map[portKey]string)
+	for _, port := range ports {
+		key := newPortKey(port.Port, port.Protocol)
+		if other, taken := servicePorts[key]; taken {
+			return errors.Errorf("ports %s and %s both use %d/%s", other, port.Name, key.port, key.protocol)
+		}
+		servicePorts[key] = port.Name
+
+		if port.NodePort == 0 {
+			continue
+		}
+		key = newPortKey(port.NodePort, port.Protocol)
+		if other, taken := nodePorts[key]; taken {
+			return errors.Errorf("ports %s and %s both use node port %d/%s", other, port.Name, key.port, key.protocol)
+		}
+		nodePorts[key] = port.Name
+	}
+	return nil
+}
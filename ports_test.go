@@ -0,0 +1,90 @@
+package kube_builders_test
+
+import (
+	"io/ioutil"
+
+	. "github.com/Twister915/kube_builders"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+var _ = Describe("Ports", func() {
+	const (
+		namespace = "test"
+		name      = "dns"
+	)
+
+	var kubeTarget *KubeTarget
+
+	BeforeEach(func() {
+		kubeTarget = NewKubeTarget(fake.NewSimpleClientset())
+	})
+
+	It("sets protocols and fixed ports", func() {
+		deployment := kubeTarget.NewPod("", namespace).Container("dns", "image", func(ctr ContainerBuilder) ContainerBuilder {
+			return ctr.Port(53, "dns").PortProtocol("dns", v1.ProtocolUDP).Port(53, "dns-tcp").HostPort("dns-tcp", 5353)
+		}).Deployment(name)
+
+		ports := deployment.AsKube().Spec.Template.Spec.Containers[0].Ports
+		Expect(ports[0].Protocol).To(Equal(v1.ProtocolUDP))
+		Expect(ports[1].HostPort).To(BeEquivalentTo(5353))
+		_, _, err := deployment.Push()
+		Expect(err).ToNot(HaveOccurred())
+
+		svc := deployment.Service(name).Type(v1.ServiceTypeNodePort).NodePort("dns", 30053)
+		servicePorts := svc.AsKube().Spec.Ports
+		Expect(servicePorts[0].Protocol).To(Equal(v1.ProtocolUDP))
+		Expect(servicePorts[0].NodePort).To(BeEquivalentTo(30053))
+		Expect(servicePorts[1].Protocol).To(BeEmpty())
+		_, _, err = svc.Push()
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("rejects ports used twice", func() {
+		_, _, err := kubeTarget.NewPod("", namespace).Container("a", "image", func(ctr ContainerBuilder) ContainerBuilder {
+			return ctr.Port(8080, "http")
+		}).Container("b", "image", func(ctr ContainerBuilder) ContainerBuilder {
+			return ctr.Port(8080, "other").PortProtocol("other", v1.ProtocolTCP)
+		}).Deployment(name).Push()
+		Expect(err).To(MatchError(ContainSubstring("both use port 8080/TCP")))
+
+		_, _, err = kubeTarget.Service(name, namespace).PortByNumber("a", 53, 53).PortByNumber("b", 54, 53).Push()
+		Expect(err).To(MatchError(ContainSubstring("both use 53/TCP")))
+	})
+
+	It("sets app protocols through an annotation", func() {
+		svc := kubeTarget.Service(name, namespace).PortByNumber("web", 8443, 443).AppProtocol("web", "HTTPS").PortByNumber("metrics", 9090, 9090)
+		Expect(svc.AsKube().Annotations).To(HaveKeyWithValue("service.alpha.kubernetes.io/app-protocols", `{"web":"HTTPS"}`))
+
+		_, _, err := kubeTarget.Service(name, namespace).PortByNumber("", 8443, 443).AppProtocol("", "HTTPS").Push()
+		Expect(err).To(MatchError(ContainSubstring("needs a name to have an app protocol")))
+	})
+
+	It("checks ports when rendering and diffing too", func() {
+		deployment := kubeTarget.NewPod("", namespace).Container("a", "image", func(ctr ContainerBuilder) ContainerBuilder {
+			return ctr.Port(8080, "http")
+		}).Container("b", "image", func(ctr ContainerBuilder) ContainerBuilder {
+			return ctr.Port(8080, "other")
+		}).Deployment(name)
+		Expect(deployment.Render(ioutil.Discard, FormatYAML)).To(MatchError(ContainSubstring("both use port 8080/TCP")))
+		_, err := deployment.Diff()
+		Expect(err).To(MatchError(ContainSubstring("both use port 8080/TCP")))
+
+		svc := kubeTarget.Service(name, namespace).PortByNumber("a", 53, 53).PortByNumber("b", 54, 53)
+		Expect(svc.Render(ioutil.Discard, FormatYAML)).To(MatchError(ContainSubstring("both use 53/TCP")))
+		_, err = svc.Diff()
+		Expect(err).To(MatchError(ContainSubstring("both use 53/TCP")))
+	})
+
+	It("only allows node ports on services exposed on nodes", func() {
+		_, _, err := kubeTarget.Service(name, namespace).PortByNumber("dns", 53, 53).NodePort("dns", 30053).Push()
+		Expect(err).To(MatchError(ContainSubstring("needs a NodePort or LoadBalancer service")))
+	})
+
+	It("panics on ports that were not added", func() {
+		Expect(func() { kubeTarget.Service(name, namespace).NodePort("dns", 30053) }).To(Panic())
+	})
+})
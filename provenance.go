@@ -0,0 +1,139 @@
+package kube_builders
+
+import (
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+const provenancePrefix = "kube-builders/"
+
+const (
+	gitShaAnnotation         = provenancePrefix + "git-sha"
+	pipelineIdAnnotation     = provenancePrefix + "pipeline-id"
+	builderVersionAnnotation = provenancePrefix + "builder-version"
+	pushedAtAnnotation       = provenancePrefix + "pushed-at"
+)
+
+// Provenance records where a pushed object came from. Empty fields are left off. Time defaults to when
+// the object is pushed, and is left off rendered objects unless set so they are the same on every run.
+type Provenance struct {
+	GitSHA         string
+	PipelineID     string
+	BuilderVersion string
+	ChangeCause    string
+	Time           time.Time
+}
+
+// WithProvenance returns a target that annotates every object it builds with provenance. Annotations the
+// caller set explicitly are kept. Pod templates only get the git SHA and builder version, so a re-run of
+// the same pipeline doesn't roll every pod. A change to the provenance is pushed like any other change,
+// only the push time is ignored when deciding whether a push changes anything.
+func (kube *KubeTarget) WithProvenance(provenance Provenance) *KubeTarget {
+	stamped := *kube
+	stamped.provenance = &provenance
+	return &stamped
+}
+
+func (kube *KubeTarget) stampProvenance(meta *meta_v1.ObjectMeta) {
+	if kube == nil || kube.provenance == nil {
+		return
+	}
+	defaults := map[string]string{
+		gitShaAnnotation:         kube.provenance.GitSHA,
+		pipelineIdAnnotation:     kube.provenance.PipelineID,
+		builderVersionAnnotation: kube.provenance.BuilderVersion,
+		changeCauseAnnotation:    kube.provenance.ChangeCause,
+	}
+	if !kube.provenance.Time.IsZero() {
+		defaults[pushedAtAnnotation] = formatPushedAt(kube.provenance.Time)
+	}
+	meta.Annotations = withDefaults(meta.Annotations, defaults)
+}
+
+func formatPushedAt(at time.Time) string {
+	return at.UTC().Format(time.RFC3339)
+}
+
+// stampPushedAt returns desired with at recorded as its push time, when it carries provenance that
+// doesn't say when it was pushed yet. desired itself is left alone, it usually still belongs to a builder.
+func stampPushedAt(desired runtime.Object, at time.Time) (stamped runtime.Object, err error) {
+	accessor, err := meta.Accessor(desired)
+	if err != nil {
+		return
+	}
+	annotations := accessor.GetAnnotations()
+	if _, set := annotations[pushedAtAnnotation]; set || !hasProvenance(annotations) {
+		return desired, nil
+	}
+
+	if obj, ok := desired.(*unstructured.Unstructured); ok {
+		copied := &unstructured.Unstructured{Object: make(map[string]interface{})}
+		for key, value := range obj.Object {
+			copied.Object[key] = value
+		}
+		metadata := make(map[string]interface{})
+		if objMetadata, ok := obj.Object["metadata"].(map[string]interface{}); ok {
+			for key, value := range objMetadata {
+				metadata[key] = value
+			}
+		}
+		copied.Object["metadata"] = metadata
+		stamped = copied
+	} else if stamped, err = scheme.Scheme.Copy(desired); err != nil {
+		return
+	}
+	if accessor, err = meta.Accessor(stamped); err != nil {
+		return
+	}
+	annotations = copyMap(annotations)
+	setAtMap(&annotations, pushedAtAnnotation, formatPushedAt(at))
+	accessor.SetAnnotations(annotations)
+	return
+}
+
+func hasProvenance(annotations map[string]string) bool {
+	for key := range annotations {
+		if isProvenanceAnnotation(key) {
+			return true
+		}
+	}
+	return false
+}
+
+func (kube *KubeTarget) stampTemplateProvenance(meta *meta_v1.ObjectMeta) {
+	if kube == nil || kube.provenance == nil {
+		return
+	}
+	meta.Annotations = withDefaults(meta.Annotations, map[string]string{
+		gitShaAnnotation:         kube.provenance.GitSHA,
+		builderVersionAnnotation: kube.provenance.BuilderVersion,
+	})
+}
+
+// withDefaults returns a copy of annotations with every non-empty default added unless already present.
+// It never modifies annotations, which is usually still owned by a builder.
+func withDefaults(annotations, defaults map[string]string) map[string]string {
+	merged := make(map[string]string)
+	for key, value := range annotations {
+		merged[key] = value
+	}
+	for key, value := range defaults {
+		if _, set := merged[key]; !set && len(value) > 0 {
+			merged[key] = value
+		}
+	}
+	if len(merged) == 0 {
+		return annotations
+	}
+	return merged
+}
+
+func isProvenanceAnnotation(key string) bool {
+	return strings.HasPrefix(key, provenancePrefix)
+}
@@ -0,0 +1,89 @@
+package kube_builders_test
+
+import (
+	"bytes"
+	"time"
+
+	. "github.com/Twister915/kube_builders"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var _ = Describe("Provenance", func() {
+	const (
+		namespace = "test"
+		name      = "test"
+	)
+
+	var kubeTarget *KubeTarget
+
+	deploy := func(target *KubeTarget) DeploymentBuilder {
+		return target.NewPod("", namespace).Container("web", "image", func(ctr ContainerBuilder) ContainerBuilder {
+			return ctr
+		}).Deployment(name)
+	}
+
+	BeforeEach(func() {
+		kubeTarget = NewKubeTarget(fake.NewSimpleClientset())
+	})
+
+	It("annotates objects and pod templates", func() {
+		stamped := kubeTarget.WithProvenance(Provenance{
+			GitSHA:      "abc123",
+			PipelineID:  "42",
+			ChangeCause: "release 1.2",
+			Time:        time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC),
+		})
+		deployment := deploy(stamped).Annotation("kube-builders/pipeline-id", "mine").AsKube()
+
+		Expect(deployment.Annotations).To(HaveKeyWithValue("kube-builders/git-sha", "abc123"))
+		Expect(deployment.Annotations).To(HaveKeyWithValue("kube-builders/pushed-at", "2017-06-01T12:00:00Z"))
+		Expect(deployment.Annotations).To(HaveKeyWithValue("kubernetes.io/change-cause", "release 1.2"))
+		By("keeping annotations set by the caller")
+		Expect(deployment.Annotations).To(HaveKeyWithValue("kube-builders/pipeline-id", "mine"))
+		By("leaving empty fields off")
+		Expect(deployment.Annotations).ToNot(HaveKey("kube-builders/builder-version"))
+
+		By("only putting stable fields on the pod template")
+		Expect(deployment.Spec.Template.Annotations).To(HaveKeyWithValue("kube-builders/git-sha", "abc123"))
+		Expect(deployment.Spec.Template.Annotations).ToNot(HaveKey("kube-builders/pushed-at"))
+
+		Expect(stamped.Service(name, namespace).AsKube().Annotations).To(HaveKey("kube-builders/git-sha"))
+		Expect(stamped.NewSecret(name, namespace).AsKube().Annotations).To(HaveKey("kube-builders/git-sha"))
+		Expect(stamped.CreateNamespace(namespace).AsKube().Annotations).To(HaveKey("kube-builders/git-sha"))
+		Expect(kubeTarget.Service(name, namespace).AsKube().Annotations).To(BeEmpty())
+	})
+
+	It("counts provenance as a change", func() {
+		_, _, err := deploy(kubeTarget.WithProvenance(Provenance{GitSHA: "one"})).Push()
+		Expect(err).ToNot(HaveOccurred())
+
+		deployment, result, err := deploy(kubeTarget.WithProvenance(Provenance{GitSHA: "two"})).Push()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Operation).To(Equal(OperationUpdated))
+		Expect(deployment.Annotations).To(HaveKeyWithValue("kube-builders/git-sha", "two"))
+
+		By("ignoring the push time")
+		_, result, err = deploy(kubeTarget.WithProvenance(Provenance{GitSHA: "two"})).Push()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Operation).To(Equal(OperationUnchanged))
+	})
+
+	It("records the push time when pushing", func() {
+		builder := deploy(kubeTarget.WithProvenance(Provenance{GitSHA: "abc123"}))
+
+		By("leaving it off rendered objects")
+		Expect(builder.AsKube().Annotations).ToNot(HaveKey("kube-builders/pushed-at"))
+		var first, second bytes.Buffer
+		Expect(builder.Render(&first, FormatYAML)).To(Succeed())
+		Expect(builder.Render(&second, FormatYAML)).To(Succeed())
+		Expect(first.String()).To(Equal(second.String()))
+
+		deployment, _, err := builder.Push()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(deployment.Annotations).To(HaveKey("kube-builders/pushed-at"))
+		Expect(builder.AsKube().Annotations).ToNot(HaveKey("kube-builders/pushed-at"))
+	})
+})
@@ -0,0 +1,219 @@
+package kube_builders
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	kube_errors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/pkg/apis/extensions/v1beta1"
+	policy_v1beta1 "k8s.io/client-go/pkg/apis/policy/v1beta1"
+	"k8s.io/client-go/rest"
+)
+
+// Operation is the kind of write a push performed, or would have performed on a dry-run target.
+type Operation string
+
+const (
+	OperationCreated   Operation = "created"
+	OperationUpdated   Operation = "updated"
+	OperationUnchanged Operation = "unchanged"
+	OperationRecreated Operation = "recreated"
+)
+
+// PushResult describes the outcome of pushing a single object. Object is the object as it was
+// persisted, or as it would have been persisted when DryRun is set. Warnings lists problems with the
+// object which didn't stop the push.
+type PushResult struct {
+	Operation Operation
+	DryRun    bool
+	Object    runtime.Object
+	Warnings  []string
+}
+
+// how often modify retries after a conflicting update
+const modifyRetries = 5
+
+// objectClient adapts one of the typed clients so create-or-update logic can be shared between kinds.
+type objectClient struct {
+	kind      string
+	resource  string
+	namespace string
+	// rest sends server dry-runs, which are simulated locally when nil
+	rest rest.Interface
+
+	newObject func() runtime.Object
+	get       func(name string) (runtime.Object, error)
+	create    func(runtime.Object) (runtime.Object, error)
+	update    func(runtime.Object) (runtime.Object, error)
+	delete    func(name string, options *meta_v1.DeleteOptions) error
+
+	// immutable returns an error when desired changes a field of live which can't be updated. The push
+	// fails with that error unless recreateImmutable is set, in which case the object is replaced.
+	immutable         func(live, desired runtime.Object) error
+	recreateImmutable bool
+
+	// prepare builds the object sent on update from the live object and the desired one. It must not
+	// modify live. When nil the desired object is sent as-is.
+	prepare func(live, desired runtime.Object) (runtime.Object, error)
+
+	// describe names the object in errors when its name alone doesn't say enough. Defaults to the name.
+	describe func(runtime.Object) string
+
+	// createOnly makes the push fail with an already exists error instead of updating a live object.
+	createOnly bool
+}
+
+func clientFor(obj runtime.Object, iface kubernetes.Interface) (client objectClient, err error) {
+	switch typed := obj.(type) {
+	case *v1beta1.Deployment:
+		client = deploymentClient(typed.Namespace, iface)
+	case *v1beta1.DaemonSet:
+		client = daemonSetClient(typed.Namespace, iface)
+	case *v1beta1.Ingress:
+		client = ingressClient(typed.Namespace, iface)
+	case *v1.Service:
+		client = serviceClient(typed.Namespace, iface)
+	case *v1.Secret:
+		client = secretClient(typed.Namespace, iface)
+	case *v1.Namespace:
+		client = namespaceClient(iface)
+	case *policy_v1beta1.PodDisruptionBudget:
+		client = disruptionBudgetClient(typed.Namespace, iface)
+	default:
+		err = errors.Errorf("unsupported object type %T", obj)
+	}
+	return
+}
+
+func (kube *KubeTarget) push(obj runtime.Object) (result PushResult, err error) {
+	client, err := clientFor(obj, kube.iface)
+	if err != nil {
+		return
+	}
+	return client.push(obj, kube.dryRun)
+}
+
+func (client objectClient) push(desired runtime.Object, mode dryRunMode) (result PushResult, err error) {
+	accessor, err := meta.Accessor(desired)
+	if err != nil {
+		return
+	}
+	name := accessor.GetName()
+	result.DryRun = mode != dryRunNone
+	if mode == dryRunServer && client.rest == nil {
+		mode = dryRunLocal
+	}
+	subject := name
+	if client.describe != nil {
+		subject = client.describe(desired)
+	}
+	if desired, err = stampPushedAt(desired, time.Now()); err != nil {
+		return
+	}
+
+	live, err := client.get(name)
+	if kube_errors.IsNotFound(err) {
+		result.Operation = OperationCreated
+		switch mode {
+		case dryRunNone:
+			result.Object, err = client.create(desired)
+		case dryRunServer:
+			result.Object, err = client.serverDryRun("POST", "", desired)
+		default:
+			result.Object, err = desired, nil
+		}
+		if err != nil {
+			err = errors.Wrapf(err, "failed to create %s %s", client.kind, subject)
+		}
+		return
+	} else if err != nil {
+		err = errors.Wrapf(err, "failed to get current %s %s", client.kind, subject)
+		return
+	}
+	if client.createOnly {
+		err = kube_errors.NewAlreadyExists(schema.GroupResource{Resource: client.resource}, name)
+		err = errors.Wrapf(err, "failed to create %s %s", client.kind, subject)
+		return
+	}
+
+	if client.immutable != nil {
+		if err = client.immutable(live, desired); err != nil {
+			if client.recreateImmutable {
+				return client.recreate(name, desired, mode)
+			}
+			err = errors.Wrapf(err, "cannot update %s %s", client.kind, subject)
+			return
+		}
+	}
+
+	next := desired
+	if client.prepare != nil {
+		if next, err = client.prepare(live, desired); err != nil {
+			err = errors.Wrapf(err, "failed to update %s %s", client.kind, subject)
+			return
+		}
+	}
+
+	// updating an unchanged object still bumps its resource version and wakes up every watcher
+	equal, err := ownedFieldsEqual(live, next)
+	if err != nil {
+		err = errors.Wrapf(err, "failed to compare %s %s", client.kind, subject)
+		return
+	}
+	if equal {
+		result.Operation = OperationUnchanged
+		result.Object = live
+		return
+	}
+
+	result.Operation = OperationUpdated
+	switch mode {
+	case dryRunNone:
+		result.Object, err = client.update(next)
+	case dryRunServer:
+		result.Object, err = client.serverDryRun("PUT", name, next)
+	default:
+		result.Object = next
+	}
+	if err != nil {
+		err = errors.Wrapf(err, "failed to update %s %s", client.kind, subject)
+	}
+	return
+}
+
+// modify reads the live object, changes it through change and updates it, unless change left it as it
+// was. The object change receives is a copy. The whole cycle is retried when someone else updated the
+// object in between.
+func (client objectClient) modify(name string, mode dryRunMode, change func(runtime.Object) error) (err error) {
+	for attempt := 0; ; attempt++ {
+		var live, next runtime.Object
+		if live, err = client.get(name); err != nil {
+			return errors.Wrapf(err, "failed to get %s %s", client.kind, name)
+		}
+		if next, err = scheme.Scheme.Copy(live); err != nil {
+			return
+		}
+		if err = change(next); err != nil {
+			return
+		}
+		var equal bool
+		if equal, err = ownedFieldsEqual(live, next); err != nil || equal || mode != dryRunNone {
+			return
+		}
+		_, err = client.update(next)
+		if !kube_errors.IsConflict(err) || attempt == modifyRetries {
+			break
+		}
+	}
+	if err != nil {
+		err = errors.Wrapf(err, "failed to update %s %s", client.kind, name)
+	}
+	return
+}
@@ -0,0 +1,61 @@
+package kube_builders
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+type Format int
+
+const (
+	FormatYAML Format = iota
+	FormatJSON
+)
+
+// Render writes objects as manifests instead of pushing them. Keys are sorted so output is stable
+// between runs. Several objects are written as a multi-document YAML stream, or as a v1 List in JSON.
+func Render(w io.Writer, format Format, objects ...runtime.Object) (err error) {
+	manifests := make([]interface{}, 0, len(objects))
+	for _, obj := range objects {
+		var fields map[string]interface{}
+		fields, err = toFields(obj)
+		if err != nil {
+			err = errors.Wrapf(err, "rendering %T", obj)
+			return
+		}
+		manifests = append(manifests, fields)
+	}
+
+	switch format {
+	case FormatYAML:
+		for i, manifest := range manifests {
+			var data []byte
+			if data, err = yaml.Marshal(manifest); err != nil {
+				return
+			}
+			if i > 0 {
+				if _, err = io.WriteString(w, "---\n"); err != nil {
+					return
+				}
+			}
+			if _, err = w.Write(data); err != nil {
+				return
+			}
+		}
+	case FormatJSON:
+		var document interface{} = map[string]interface{}{"apiVersion": "v1", "kind": "List", "items": manifests}
+		if len(manifests) == 1 {
+			document = manifests[0]
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(document)
+	default:
+		err = errors.Errorf("unknown format %d", format)
+	}
+	return
+}
@@ -0,0 +1,68 @@
+package kube_builders_test
+
+import (
+	"bytes"
+	"encoding/json"
+
+	. "github.com/Twister915/kube_builders"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var _ = Describe("Render", func() {
+	const (
+		namespace = "test"
+		name      = "test"
+	)
+
+	var kubeTarget *KubeTarget
+
+	BeforeEach(func() {
+		kubeTarget = NewKubeTarget(fake.NewSimpleClientset())
+	})
+
+	It("renders a single object as yaml", func() {
+		var out bytes.Buffer
+		err := kubeTarget.Service(name, namespace).Selector("app", name).PortByNumber("http", 80, 80).Render(&out, FormatYAML)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(out.String()).To(HavePrefix("apiVersion: v1\nkind: Service\nmetadata:\n"))
+		Expect(out.String()).ToNot(ContainSubstring("status"))
+		Expect(out.String()).ToNot(ContainSubstring("---"))
+	})
+
+	It("renders the same output every time", func() {
+		svc := kubeTarget.Service(name, namespace).Label("b", 2).Label("a", 1).Label("c", 3)
+		var first, second bytes.Buffer
+		Expect(svc.Render(&first, FormatYAML)).To(Succeed())
+		Expect(svc.Render(&second, FormatYAML)).To(Succeed())
+		Expect(first.String()).To(Equal(second.String()))
+	})
+
+	It("renders collections as multiple documents", func() {
+		objects := []runtime.Object{
+			kubeTarget.CreateNamespace(namespace).AsKube(),
+			kubeTarget.NewSecret(name, namespace).Value("key", "value").AsKube(),
+		}
+
+		var yamlOut bytes.Buffer
+		Expect(Render(&yamlOut, FormatYAML, objects...)).To(Succeed())
+		Expect(yamlOut.String()).To(ContainSubstring("kind: Namespace\n"))
+		Expect(yamlOut.String()).To(ContainSubstring("\n---\n"))
+		Expect(yamlOut.String()).To(ContainSubstring("kind: Secret\n"))
+
+		var jsonOut bytes.Buffer
+		Expect(Render(&jsonOut, FormatJSON, objects...)).To(Succeed())
+		var list struct {
+			Kind  string
+			Items []map[string]interface{}
+		}
+		Expect(json.Unmarshal(jsonOut.Bytes(), &list)).To(Succeed())
+		Expect(list.Kind).To(Equal("List"))
+		Expect(list.Items).To(HaveLen(2))
+		Expect(list.Items[0]).To(HaveKeyWithValue("apiVersion", "v1"))
+		Expect(list.Items[1]).To(HaveKeyWithValue("kind", "Secret"))
+	})
+})
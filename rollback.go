@@ -0,0 +1,194 @@
+package kube_builders
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/pkg/apis/extensions/v1beta1"
+)
+
+// RolloutFailedError is returned by PushAndWait and PushDeploymentAndWait when a rollout failed and the deployment was rolled back
+// to how it was before the push. Err is why the rollout failed and RollbackErr is set when restoring the
+// previous deployment failed as well.
+type RolloutFailedError struct {
+	Err         error
+	Rollback    PushResult
+	RollbackErr error
+}
+
+func (err *RolloutFailedError) Error() string {
+	if err.RollbackErr != nil {
+		return fmt.Sprintf("%v; rollback failed: %v", err.Err, err.RollbackErr)
+	}
+	return fmt.Sprintf("%v; rolled back (%s)", err.Err, err.Rollback.Operation)
+}
+
+// Cause returns the rollout failure, so errors.Cause unwraps to it.
+func (err *RolloutFailedError) Cause() error {
+	return err.Err
+}
+
+// rollbackDeployment pushes previous back through client after a failed rollout.
+func rollbackDeployment(client objectClient, previous *v1beta1.Deployment, rolloutErr error) error {
+	restore := *previous
+	restore.ResourceVersion = ""
+	restore.Status = v1beta1.DeploymentStatus{}
+
+	failed := &RolloutFailedError{Err: rolloutErr}
+	failed.Rollback, failed.RollbackErr = client.push(&restore, dryRunNone)
+	return failed
+}
+
+const (
+	revisionAnnotation    = "deployment.kubernetes.io/revision"
+	changeCauseAnnotation = "kubernetes.io/change-cause"
+	podTemplateHashLabel  = "pod-template-hash"
+)
+
+// DeploymentRevision is one entry in the rollout history of a deployment, backed by a replica set. Diff
+// is a unified diff of the pod template against the previous revision.
+type DeploymentRevision struct {
+	Revision    int64
+	ReplicaSet  string
+	ChangeCause string
+	Created     time.Time
+	Current     bool
+	Template    v1.PodTemplateSpec
+	Diff        string
+}
+
+// DeploymentHistory lists the revisions of a deployment that are still retained, oldest first.
+func (kube *KubeTarget) DeploymentHistory(name, namespace string) (history []DeploymentRevision, err error) {
+	deployment, err := kube.iface.ExtensionsV1beta1().Deployments(namespace).Get(name, meta_v1.GetOptions{})
+	if err != nil {
+		err = errors.Wrapf(err, "failed to get deployment %s", name)
+		return
+	}
+	replicaSets, err := ownedReplicaSets(deployment, kube.iface)
+	if err != nil {
+		return
+	}
+
+	current := deployment.Annotations[revisionAnnotation]
+	for _, rs := range replicaSets {
+		revision, parseErr := strconv.ParseInt(rs.Annotations[revisionAnnotation], 10, 64)
+		if parseErr != nil {
+			continue
+		}
+		history = append(history, DeploymentRevision{
+			Revision:    revision,
+			ReplicaSet:  rs.Name,
+			ChangeCause: rs.Annotations[changeCauseAnnotation],
+			Created:     rs.CreationTimestamp.Time,
+			Current:     rs.Annotations[revisionAnnotation] == current,
+			Template:    revisionTemplate(rs),
+		})
+	}
+	sort.Slice(history, func(i, j int) bool { return history[i].Revision < history[j].Revision })
+
+	var previous interface{}
+	for i := range history {
+		title := fmt.Sprintf("revision %d", history[i].Revision)
+		previousTitle := "empty"
+		if i > 0 {
+			previousTitle = fmt.Sprintf("revision %d", history[i-1].Revision)
+		}
+		history[i].Diff, err = unifiedDiff(previous, history[i].Template, previousTitle, title)
+		if err != nil {
+			return
+		}
+		previous = history[i].Template
+	}
+	return
+}
+
+// RollbackDeployment puts the pod template of an earlier revision back on a deployment, like kubectl
+// rollout undo. A revision of 0 rolls back to the revision before the current one.
+func (kube *KubeTarget) RollbackDeployment(name, namespace string, revision int64) (result PushResult, err error) {
+	history, err := kube.DeploymentHistory(name, namespace)
+	if err != nil {
+		return
+	}
+
+	target := -1
+	for i, entry := range history {
+		if revision == 0 && entry.Current {
+			target = i - 1
+		} else if revision != 0 && entry.Revision == revision {
+			target = i
+		}
+	}
+	if target < 0 {
+		if revision == 0 {
+			err = errors.Errorf("deployment %s has no previous revision to roll back to", name)
+		} else {
+			err = errors.Errorf("deployment %s has no revision %d", name, revision)
+		}
+		return
+	}
+
+	deployment, err := kube.iface.ExtensionsV1beta1().Deployments(namespace).Get(name, meta_v1.GetOptions{})
+	if err != nil {
+		err = errors.Wrapf(err, "failed to get deployment %s", name)
+		return
+	}
+	deployment.Spec.Template = history[target].Template
+	if cause := history[target].ChangeCause; len(cause) > 0 {
+		setAtMap(&deployment.Annotations, changeCauseAnnotation, cause)
+	}
+	return deploymentClient(namespace, kube.iface).push(deployment, kube.dryRun)
+}
+
+func ownedReplicaSets(deployment *v1beta1.Deployment, iface kubernetes.Interface) (owned []v1beta1.ReplicaSet, err error) {
+	options := meta_v1.ListOptions{}
+	if deployment.Spec.Selector != nil {
+		var selector labels.Selector
+		if selector, err = meta_v1.LabelSelectorAsSelector(deployment.Spec.Selector); err != nil {
+			return
+		}
+		options.LabelSelector = selector.String()
+	}
+
+	replicaSets, err := iface.ExtensionsV1beta1().ReplicaSets(deployment.Namespace).List(options)
+	if err != nil {
+		err = errors.Wrapf(err, "failed to list replica sets of deployment %s", deployment.Name)
+		return
+	}
+	for _, rs := range replicaSets.Items {
+		// replica sets created before owner references existed only match by selector
+		if len(rs.OwnerReferences) == 0 {
+			owned = append(owned, rs)
+			continue
+		}
+		for _, owner := range rs.OwnerReferences {
+			if owner.UID == deployment.UID {
+				owned = append(owned, rs)
+				break
+			}
+		}
+	}
+	return
+}
+
+// revisionTemplate is the pod template of a replica set without the hash label the deployment controller
+// adds to it.
+func revisionTemplate(rs v1beta1.ReplicaSet) (template v1.PodTemplateSpec) {
+	template = rs.Spec.Template
+	if _, ok := template.Labels[podTemplateHashLabel]; ok {
+		withoutHash := make(map[string]string)
+		for key, value := range template.Labels {
+			if key != podTemplateHashLabel {
+				withoutHash[key] = value
+			}
+		}
+		template.Labels = withoutHash
+	}
+	return
+}
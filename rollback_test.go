@@ -0,0 +1,97 @@
+package kube_builders_test
+
+import (
+	"fmt"
+
+	. "github.com/Twister915/kube_builders"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/pkg/apis/extensions/v1beta1"
+)
+
+var _ = Describe("Deployment History", func() {
+	const (
+		namespace = "test"
+		name      = "test"
+
+		containerName = "web"
+	)
+
+	var (
+		fakeKubernetes kubernetes.Interface
+		kubeTarget     *KubeTarget
+	)
+
+	deploy := func(image string) DeploymentBuilder {
+		return kubeTarget.NewPod("", namespace).Label("app", name).Container(containerName, image, func(ctr ContainerBuilder) ContainerBuilder {
+			return ctr
+		}).Deployment(name)
+	}
+
+	// the fake client has no deployment controller, so record revisions the way it would
+	revision := func(number int, image, cause string) {
+		deployment, _, err := deploy(image).Annotation("deployment.kubernetes.io/revision", number).Push()
+		Expect(err).ToNot(HaveOccurred())
+
+		var rs v1beta1.ReplicaSet
+		rs.Name = fmt.Sprintf("%s-%d", name, number)
+		rs.Namespace = namespace
+		rs.Labels = map[string]string{"app": name}
+		rs.Annotations = map[string]string{
+			"deployment.kubernetes.io/revision": fmt.Sprint(number),
+			"kubernetes.io/change-cause":        cause,
+		}
+		rs.Spec.Template = deployment.Spec.Template
+		rs.Spec.Template.Labels = map[string]string{"app": name, "pod-template-hash": fmt.Sprint(number)}
+		_, err = fakeKubernetes.ExtensionsV1beta1().ReplicaSets(namespace).Create(&rs)
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	BeforeEach(func() {
+		fakeKubernetes = fake.NewSimpleClientset()
+		kubeTarget = NewKubeTarget(fakeKubernetes)
+
+		revision(2, "image:v2", "upgrade to v2")
+		revision(1, "image:v1", "first release")
+		revision(3, "image:v3", "upgrade to v3")
+	})
+
+	It("lists revisions oldest first", func() {
+		history, err := kubeTarget.DeploymentHistory(name, namespace)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(history).To(HaveLen(3))
+		Expect(history[0].Revision).To(BeEquivalentTo(1))
+		Expect(history[0].ChangeCause).To(Equal("first release"))
+		Expect(history[2].Current).To(BeTrue())
+		Expect(history[2].Template.Labels).ToNot(HaveKey("pod-template-hash"))
+		Expect(history[1].Diff).To(ContainSubstring("-  - image: image:v1"))
+		Expect(history[1].Diff).To(ContainSubstring("+  - image: image:v2"))
+	})
+
+	It("rolls back to a revision", func() {
+		By("going back one revision by default")
+		result, err := kubeTarget.RollbackDeployment(name, namespace, 0)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Operation).To(Equal(OperationUpdated))
+
+		live, err := fakeKubernetes.ExtensionsV1beta1().Deployments(namespace).Get(name, meta_v1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(live.Spec.Template.Spec.Containers[0].Image).To(Equal("image:v2"))
+		Expect(live.Annotations).To(HaveKeyWithValue("kubernetes.io/change-cause", "upgrade to v2"))
+
+		By("going back to a chosen revision")
+		_, err = kubeTarget.RollbackDeployment(name, namespace, 1)
+		Expect(err).ToNot(HaveOccurred())
+		live, err = fakeKubernetes.ExtensionsV1beta1().Deployments(namespace).Get(name, meta_v1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(live.Spec.Template.Spec.Containers[0].Image).To(Equal("image:v1"))
+
+		By("refusing unknown revisions")
+		_, err = kubeTarget.RollbackDeployment(name, namespace, 7)
+		Expect(err).To(HaveOccurred())
+	})
+})
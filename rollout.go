@@ -0,0 +1,261 @@
+package kube_builders
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	kube_errors "k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/pkg/apis/extensions/v1beta1"
+)
+
+const rolloutPollInterval = 2 * time.Second
+
+// reason set on the Progressing condition once a deployment exceeds its progress deadline
+const progressDeadlineExceeded = "ProgressDeadlineExceeded"
+
+// RolloutEvent reports the progress of a rollout, in the same terms as kubectl rollout status.
+type RolloutEvent struct {
+	Kind      string
+	Namespace string
+	Name      string
+	Message   string
+	Done      bool
+}
+
+// rolloutStatus checks a workload once, returning whether the rollout is done and a description of what
+// it is waiting for. An error means the rollout failed and waiting any longer won't help, so errors talking
+// to the server are reported in the message instead.
+type rolloutStatus func() (done bool, message string, err error)
+
+func (deployment DeploymentBuilder) PushAndWait(ctx context.Context, progress func(RolloutEvent)) (kubeDeployment *v1beta1.Deployment, result PushResult, err error) {
+	rollback := deployment.rollbackOnFailure && !deployment.kube.IsDryRun()
+	return pushDeploymentAndWait(ctx, deployment.client(), deployment.name, deployment.namespace, deployment.kube.iface, rollback, deployment.Push, progress)
+}
+
+// PushDeploymentAndWait pushes kubeDeployment like PushDeployment, then waits for its rollout like
+// WaitForDeployment. With rollbackOnFailure a failed rollout restores the deployment as it was before the
+// push, and the error is a *RolloutFailedError.
+func PushDeploymentAndWait(ctx context.Context, kubeDeployment *v1beta1.Deployment, iface kubernetes.Interface, rollbackOnFailure bool, progress func(RolloutEvent)) (result PushResult, err error) {
+	client := deploymentClient(kubeDeployment.Namespace, iface)
+	push := func() (persisted *v1beta1.Deployment, result PushResult, err error) {
+		persisted = kubeDeployment
+		result, err = client.push(kubeDeployment, dryRunNone)
+		if pushed, ok := result.Object.(*v1beta1.Deployment); ok {
+			persisted = pushed
+		}
+		return
+	}
+	_, result, err = pushDeploymentAndWait(ctx, client, kubeDeployment.Name, kubeDeployment.Namespace, iface, rollbackOnFailure, push, progress)
+	return
+}
+
+// pushDeploymentAndWait records the live deployment when rollback is set, pushes and waits for the
+// rollout, and restores the recorded deployment through client if the rollout fails.
+func pushDeploymentAndWait(ctx context.Context, client objectClient, name, namespace string, iface kubernetes.Interface, rollback bool, push func() (*v1beta1.Deployment, PushResult, error), progress func(RolloutEvent)) (kubeDeployment *v1beta1.Deployment, result PushResult, err error) {
+	var previous *v1beta1.Deployment
+	if rollback {
+		previous, err = iface.ExtensionsV1beta1().Deployments(namespace).Get(name, meta_v1.GetOptions{})
+		if kube_errors.IsNotFound(err) {
+			previous, err = nil, nil
+		} else if err != nil {
+			err = errors.Wrapf(err, "failed to record deployment %s before updating", name)
+			return
+		}
+	}
+
+	kubeDeployment, result, err = push()
+	if err != nil || result.DryRun {
+		return
+	}
+	err = WaitForDeployment(ctx, kubeDeployment, iface, progress)
+	if err != nil && previous != nil && result.Operation != OperationUnchanged {
+		err = rollbackDeployment(client, previous, err)
+	}
+	return
+}
+
+func (ds DaemonSetBuilder) PushAndWait(ctx context.Context, progress func(RolloutEvent)) (kubeDs *v1beta1.DaemonSet, result PushResult, err error) {
+	kubeDs, result, err = ds.Push()
+	if err != nil || result.DryRun {
+		return
+	}
+	err = WaitForDaemonSet(ctx, kubeDs, ds.kube.iface, progress)
+	return
+}
+
+// WaitForDeployment blocks until every replica of the deployment runs the current pod template, the
+// deployment exceeds its progress deadline, or ctx is done.
+func WaitForDeployment(ctx context.Context, kubeDeployment *v1beta1.Deployment, iface kubernetes.Interface, progress func(RolloutEvent)) error {
+	deployments := iface.ExtensionsV1beta1().Deployments(kubeDeployment.Namespace)
+	selector := kubeDeployment.Spec.Selector
+	status := func() (done bool, message string, err error) {
+		live, err := deployments.Get(kubeDeployment.Name, meta_v1.GetOptions{})
+		if err != nil {
+			// a failed request says nothing about the rollout, so it is reported and tried again
+			return false, fmt.Sprintf("failed to get current deployment, retrying: %v", err), nil
+		}
+		selector = live.Spec.Selector
+		done, message, err = deploymentRolloutStatus(live)
+		return
+	}
+	return waitForRollout(ctx, "deployment", kubeDeployment.Namespace, kubeDeployment.Name, status, progress, func() string {
+		return podProblems(iface, kubeDeployment.Namespace, selector)
+	})
+}
+
+// WaitForDaemonSet blocks until every scheduled pod of the daemon set runs the current pod template or
+// ctx is done.
+func WaitForDaemonSet(ctx context.Context, kubeDs *v1beta1.DaemonSet, iface kubernetes.Interface, progress func(RolloutEvent)) error {
+	dses := iface.ExtensionsV1beta1().DaemonSets(kubeDs.Namespace)
+	selector := kubeDs.Spec.Selector
+	status := func() (done bool, message string, err error) {
+		live, err := dses.Get(kubeDs.Name, meta_v1.GetOptions{})
+		if err != nil {
+			// a failed request says nothing about the rollout, so it is reported and tried again
+			return false, fmt.Sprintf("failed to get current daemon set, retrying: %v", err), nil
+		}
+		selector = live.Spec.Selector
+		done, message, err = daemonSetRolloutStatus(live)
+		return
+	}
+	return waitForRollout(ctx, "daemon set", kubeDs.Namespace, kubeDs.Name, status, progress, func() string {
+		return podProblems(iface, kubeDs.Namespace, selector)
+	})
+}
+
+func waitForRollout(ctx context.Context, kind, namespace, name string, status rolloutStatus, progress func(RolloutEvent), problems func() string) error {
+	ticker := time.NewTicker(rolloutPollInterval)
+	defer ticker.Stop()
+
+	var lastMessage string
+	for {
+		done, message, err := status()
+		if err != nil {
+			return errors.Wrapf(err, "rollout of %s %s failed%s", kind, name, problems())
+		}
+		if progress != nil && (done || message != lastMessage) {
+			progress(RolloutEvent{Kind: kind, Namespace: namespace, Name: name, Message: message, Done: done})
+		}
+		if done {
+			return nil
+		}
+		lastMessage = message
+
+		select {
+		case <-ctx.Done():
+			return errors.Errorf("rollout of %s %s did not finish: %s%s", kind, name, lastMessage, problems())
+		case <-ticker.C:
+		}
+	}
+}
+
+func deploymentRolloutStatus(deployment *v1beta1.Deployment) (done bool, message string, err error) {
+	if deployment.Generation > deployment.Status.ObservedGeneration {
+		message = "waiting for deployment spec update to be observed"
+		return
+	}
+
+	for _, condition := range deployment.Status.Conditions {
+		if condition.Type == v1beta1.DeploymentProgressing && condition.Reason == progressDeadlineExceeded {
+			err = errors.Errorf("deployment exceeded its progress deadline: %s", condition.Message)
+			return
+		}
+	}
+
+	status := deployment.Status
+	switch {
+	case deployment.Spec.Replicas != nil && status.UpdatedReplicas < *deployment.Spec.Replicas:
+		message = fmt.Sprintf("%d out of %d new replicas have been updated", status.UpdatedReplicas, *deployment.Spec.Replicas)
+	case status.Replicas > status.UpdatedReplicas:
+		message = fmt.Sprintf("%d old replicas are pending termination", status.Replicas-status.UpdatedReplicas)
+	case status.AvailableReplicas < status.UpdatedReplicas:
+		message = fmt.Sprintf("%d of %d updated replicas are available", status.AvailableReplicas, status.UpdatedReplicas)
+	default:
+		message = "successfully rolled out"
+		done = true
+	}
+	return
+}
+
+func daemonSetRolloutStatus(ds *v1beta1.DaemonSet) (done bool, message string, err error) {
+	if ds.Generation > ds.Status.ObservedGeneration {
+		message = "waiting for daemon set spec update to be observed"
+		return
+	}
+
+	status := ds.Status
+	switch {
+	case ds.Spec.UpdateStrategy.Type != v1beta1.RollingUpdateDaemonSetStrategyType:
+		// pods are only replaced once deleted, so there is no rollout to wait for
+		message = "update strategy is not rolling"
+		done = true
+	case status.UpdatedNumberScheduled < status.DesiredNumberScheduled:
+		message = fmt.Sprintf("%d out of %d new pods have been updated", status.UpdatedNumberScheduled, status.DesiredNumberScheduled)
+	case status.NumberAvailable < status.DesiredNumberScheduled:
+		message = fmt.Sprintf("%d of %d updated pods are available", status.NumberAvailable, status.DesiredNumberScheduled)
+	default:
+		message = "successfully rolled out"
+		done = true
+	}
+	return
+}
+
+// podProblems describes why pods matching selector are not becoming ready, such as crash loops and image
+// pull failures, for use at the end of an error message.
+func podProblems(iface kubernetes.Interface, namespace string, selector *meta_v1.LabelSelector) string {
+	if selector == nil {
+		return ""
+	}
+	parsed, err := meta_v1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return ""
+	}
+	pods, err := iface.CoreV1().Pods(namespace).List(meta_v1.ListOptions{LabelSelector: parsed.String()})
+	if err != nil {
+		return ""
+	}
+
+	var problems []string
+	for _, pod := range pods.Items {
+		for _, status := range pod.Status.ContainerStatuses {
+			if problem := containerProblem(status); len(problem) > 0 {
+				problems = append(problems, fmt.Sprintf("pod %s container %s: %s", pod.Name, status.Name, problem))
+			}
+		}
+	}
+	if len(problems) == 0 {
+		return ""
+	}
+	return "; " + strings.Join(problems, "; ")
+}
+
+func containerProblem(status v1.ContainerStatus) string {
+	if status.Ready {
+		return ""
+	}
+
+	var problem string
+	if waiting := status.State.Waiting; waiting != nil && len(waiting.Reason) > 0 && waiting.Reason != "ContainerCreating" {
+		problem = waiting.Reason
+		if len(waiting.Message) > 0 {
+			problem += " (" + waiting.Message + ")"
+		}
+	}
+	if terminated := status.LastTerminationState.Terminated; terminated != nil {
+		if len(problem) > 0 {
+			problem += ", "
+		}
+		problem += fmt.Sprintf("last exit code %d", terminated.ExitCode)
+		if len(terminated.Reason) > 0 {
+			problem += " (" + terminated.Reason + ")"
+		}
+		problem += fmt.Sprintf(" after %d restarts", status.RestartCount)
+	}
+	return problem
+}
@@ -0,0 +1,177 @@
+package kube_builders_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/Twister915/kube_builders"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/pkg/apis/extensions/v1beta1"
+	core "k8s.io/client-go/testing"
+)
+
+var _ = Describe("Rollout", func() {
+	const (
+		namespace = "test"
+		name      = "test"
+
+		containerName  = "web"
+		containerImage = "docker.spectonic.com/test/123"
+	)
+
+	var (
+		fakeKubernetes kubernetes.Interface
+		kubeTarget     *KubeTarget
+		events         []RolloutEvent
+	)
+
+	deploy := func() DeploymentBuilder {
+		return kubeTarget.NewPod("", namespace).Label("app", name).Container(containerName, containerImage, func(ctr ContainerBuilder) ContainerBuilder {
+			return ctr
+		}).Deployment(name).Replicas(2)
+	}
+
+	record := func(event RolloutEvent) {
+		events = append(events, event)
+	}
+
+	BeforeEach(func() {
+		fakeKubernetes = fake.NewSimpleClientset()
+		kubeTarget = NewKubeTarget(fakeKubernetes)
+		events = nil
+	})
+
+	It("returns once the rollout finished", func() {
+		deployment, _, err := deploy().Push()
+		Expect(err).ToNot(HaveOccurred())
+
+		deployment.Status.Replicas = 2
+		deployment.Status.UpdatedReplicas = 2
+		deployment.Status.AvailableReplicas = 2
+		_, err = fakeKubernetes.ExtensionsV1beta1().Deployments(namespace).UpdateStatus(deployment)
+		Expect(err).ToNot(HaveOccurred())
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		Expect(WaitForDeployment(ctx, deployment, fakeKubernetes, record)).To(Succeed())
+		Expect(events).ToNot(BeEmpty())
+		Expect(events[len(events)-1].Done).To(BeTrue())
+	})
+
+	It("explains why a rollout did not finish", func() {
+		var crashing v1.Pod
+		crashing.Name = name + "-abc"
+		crashing.Namespace = namespace
+		crashing.Labels = map[string]string{"app": name}
+		crashing.Status.ContainerStatuses = []v1.ContainerStatus{{
+			Name:         containerName,
+			RestartCount: 4,
+			State:        v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+			LastTerminationState: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{
+				ExitCode: 1,
+				Reason:   "Error",
+			}},
+		}}
+		_, err := fakeKubernetes.CoreV1().Pods(namespace).Create(&crashing)
+		Expect(err).ToNot(HaveOccurred())
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		_, _, err = deploy().PushAndWait(ctx, record)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("0 out of 2 new replicas have been updated"))
+		Expect(err.Error()).To(ContainSubstring("CrashLoopBackOff"))
+		Expect(err.Error()).To(ContainSubstring("last exit code 1"))
+		Expect(events).To(HaveLen(1))
+		Expect(events[0].Done).To(BeFalse())
+	})
+
+	It("keeps waiting when checking on the rollout fails", func() {
+		deployment, _, err := deploy().Push()
+		Expect(err).ToNot(HaveOccurred())
+		deployment.Status.Replicas = 2
+		deployment.Status.UpdatedReplicas = 2
+		deployment.Status.AvailableReplicas = 2
+		_, err = fakeKubernetes.ExtensionsV1beta1().Deployments(namespace).UpdateStatus(deployment)
+		Expect(err).ToNot(HaveOccurred())
+
+		failures := 1
+		fakeKubernetes.(*fake.Clientset).PrependReactor("get", "deployments", func(core.Action) (bool, runtime.Object, error) {
+			if failures == 0 {
+				return false, nil, nil
+			}
+			failures--
+			return true, nil, errors.New("connection refused")
+		})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		Expect(WaitForDeployment(ctx, deployment, fakeKubernetes, record)).To(Succeed())
+		Expect(events[0].Message).To(ContainSubstring("connection refused"))
+		Expect(events[len(events)-1].Done).To(BeTrue())
+	})
+
+	It("fails once the progress deadline is exceeded", func() {
+		deployment, _, err := deploy().Push()
+		Expect(err).ToNot(HaveOccurred())
+
+		deployment.Status.Conditions = append(deployment.Status.Conditions, v1beta1.DeploymentCondition{
+			Type:   v1beta1.DeploymentProgressing,
+			Status: v1.ConditionFalse,
+			Reason: "ProgressDeadlineExceeded",
+		})
+		_, err = fakeKubernetes.ExtensionsV1beta1().Deployments(namespace).UpdateStatus(deployment)
+		Expect(err).ToNot(HaveOccurred())
+
+		err = WaitForDeployment(context.Background(), deployment, fakeKubernetes, nil)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("progress deadline"))
+	})
+
+	It("rolls back a failed rollout when asked to", func() {
+		_, _, err := deploy().Push()
+		Expect(err).ToNot(HaveOccurred())
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		broken := kubeTarget.NewPod("", namespace).Label("app", name).Container(containerName, containerImage+"-broken", func(ctr ContainerBuilder) ContainerBuilder {
+			return ctr
+		}).Deployment(name).Replicas(2).RollbackOnFailure()
+		_, _, err = broken.PushAndWait(ctx, nil)
+		Expect(err).To(HaveOccurred())
+
+		failed, ok := err.(*RolloutFailedError)
+		Expect(ok).To(BeTrue())
+		Expect(failed.RollbackErr).ToNot(HaveOccurred())
+		Expect(failed.Rollback.Operation).To(Equal(OperationUpdated))
+
+		live, err := fakeKubernetes.ExtensionsV1beta1().Deployments(namespace).Get(name, meta_v1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(live.Spec.Template.Spec.Containers[0].Image).To(Equal(containerImage))
+	})
+	It("rolls back a failed rollout pushed without a builder", func() {
+		_, _, err := deploy().Push()
+		Expect(err).ToNot(HaveOccurred())
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		broken := deploy().AsKube()
+		broken.Spec.Template.Spec.Containers[0].Image = containerImage + "-broken"
+		_, err = PushDeploymentAndWait(ctx, broken, fakeKubernetes, true, nil)
+		failed, ok := err.(*RolloutFailedError)
+		Expect(ok).To(BeTrue())
+		Expect(failed.RollbackErr).ToNot(HaveOccurred())
+
+		live, err := fakeKubernetes.ExtensionsV1beta1().Deployments(namespace).Get(name, meta_v1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(live.Spec.Template.Spec.Containers[0].Image).To(Equal(containerImage))
+	})
+})
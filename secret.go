@@ -1,9 +1,12 @@
 package kube_builders
 
 import (
+	"io"
+
 	"github.com/pkg/errors"
 	kube_errors "k8s.io/apimachinery/pkg/api/errors"
 	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/pkg/api/v1"
 )
@@ -61,10 +64,12 @@ func (secret SecretBuilder) Annotation(annotation string, value interface{}) Sec
 
 func (secret SecretBuilder) AsKube() (kubeSecret *v1.Secret) {
 	kubeSecret = new(v1.Secret)
+	kubeSecret.TypeMeta = meta_v1.TypeMeta{Kind: "Secret", APIVersion: v1.SchemeGroupVersion.String()}
 	kubeSecret.Name = secret.name
 	kubeSecret.Namespace = secret.namespace
 	kubeSecret.Labels = secret.labels
 	kubeSecret.Annotations = secret.annotations
+	secret.kube.stampProvenance(&kubeSecret.ObjectMeta)
 	if secret.keys != nil {
 		kubeSecret.StringData = make(map[string]string)
 		for key, value := range secret.keys {
@@ -74,32 +79,46 @@ func (secret SecretBuilder) AsKube() (kubeSecret *v1.Secret) {
 	return
 }
 
-func (secret SecretBuilder) Push() (kubeSecret *v1.Secret, err error) {
-	kubeSecret = secret.AsKube()
-	err = PushSecret(kubeSecret, secret.kube.iface)
-	return
+func (secret SecretBuilder) Render(w io.Writer, format Format) error {
+	return Render(w, format, secret.AsKube())
 }
 
-func PushSecret(kubeSecret *v1.Secret, iface kubernetes.Interface) (err error) {
-	secrets := iface.CoreV1().Secrets(kubeSecret.Namespace)
-	exists, err := DoesSecretExist(kubeSecret.Namespace, kubeSecret.Name, iface)
-	if err != nil {
-		err = errors.Wrapf(err, "could not check if secret exists")
-		return
-	}
+func (secret SecretBuilder) Diff() (ObjectDiff, error) {
+	return secret.kube.diff(secret.AsKube())
+}
 
-	var f func(*v1.Secret) (*v1.Secret, error)
-	if exists {
-		f = secrets.Update
-	} else {
-		f = secrets.Create
+func (secret SecretBuilder) Push() (kubeSecret *v1.Secret, result PushResult, err error) {
+	kubeSecret = secret.AsKube()
+	result, err = secret.kube.push(kubeSecret)
+	if persisted, ok := result.Object.(*v1.Secret); ok {
+		kubeSecret = persisted
 	}
+	return
+}
 
-	_, err = f(kubeSecret)
-	if err != nil {
-		err = errors.Wrapf(err, "creating secret %s", kubeSecret.Name)
+func PushSecret(kubeSecret *v1.Secret, iface kubernetes.Interface) (result PushResult, err error) {
+	return secretClient(kubeSecret.Namespace, iface).push(kubeSecret, dryRunNone)
+}
+
+func secretClient(namespace string, iface kubernetes.Interface) objectClient {
+	secrets := iface.CoreV1().Secrets(namespace)
+	return objectClient{
+		kind:      "secret",
+		resource:  "secrets",
+		namespace: namespace,
+		rest:      iface.CoreV1().RESTClient(),
+		newObject: func() runtime.Object { return new(v1.Secret) },
+		get: func(name string) (runtime.Object, error) {
+			return secrets.Get(name, meta_v1.GetOptions{})
+		},
+		create: func(obj runtime.Object) (runtime.Object, error) {
+			return secrets.Create(obj.(*v1.Secret))
+		},
+		update: func(obj runtime.Object) (runtime.Object, error) {
+			return secrets.Update(obj.(*v1.Secret))
+		},
+		delete: secrets.Delete,
 	}
-	return
 }
 
 func DoesSecretExist(namespace, name string, iface kubernetes.Interface) (exists bool, err error) {
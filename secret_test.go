@@ -5,6 +5,7 @@ import (
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/fake"
 )
@@ -46,10 +47,42 @@ var _ = Describe("Secret Generator", func() {
 		for key, value := range secretData {
 			secret = secret.Value(key, value)
 		}
-		_, err := secret.Push()
+		_, _, err := secret.Push()
 		Expect(err).ToNot(HaveOccurred())
 	})
 
+	It("does not update an unchanged secret", func() {
+		secret := kubeTarget.NewSecret(secretName, namespace)
+		for key, value := range secretData {
+			secret = secret.Value(key, value)
+		}
+		kubeSecret := secret.AsKube()
+		kubeSecret.Data = make(map[string][]byte)
+		for key, value := range kubeSecret.StringData {
+			kubeSecret.Data[key] = []byte(value)
+		}
+		kubeSecret.StringData = nil
+		_, err := fakeKubernetes.CoreV1().Secrets(namespace).Create(kubeSecret)
+		Expect(err).ToNot(HaveOccurred())
+
+		_, result, err := secret.Push()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Operation).To(Equal(OperationUnchanged))
+	})
+
+	It("updates when a key is removed", func() {
+		_, _, err := kubeTarget.NewSecret(secretName, namespace).Value("a", "1").Value("b", "2").Push()
+		Expect(err).ToNot(HaveOccurred())
+
+		_, result, err := kubeTarget.NewSecret(secretName, namespace).Value("a", "1").Push()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Operation).To(Equal(OperationUpdated))
+
+		live, err := fakeKubernetes.CoreV1().Secrets(namespace).Get(secretName, meta_v1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(live.StringData).To(Equal(map[string]string{"a": "1"}))
+	})
+
 	It("can get secrets from kubernetes", func() {
 		//create a secret
 		By("creating a fake secret")
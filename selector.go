@@ -0,0 +1,133 @@
+package kube_builders
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/pkg/errors"
+	kube_errors "k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// label given to pods that have none, so their workload has something to select them by
+const defaultSelectorLabel = "app"
+
+const (
+	recreatePollInterval = time.Second
+	recreateTimeout      = 2 * time.Minute
+)
+
+// templateLabels returns the labels for the pod template of a workload: the pod labels, plus any label
+// of an explicit selector the pod doesn't set, so the selector matches its own pods. When neither the pod
+// nor the selector has any, defaultSelectorLabel is set to the workload name.
+func templateLabels(name string, explicit, podLabels map[string]string) map[string]string {
+	if len(explicit) == 0 && len(podLabels) == 0 {
+		return map[string]string{defaultSelectorLabel: name}
+	}
+	merged := copyMap(podLabels)
+	for key, value := range explicit {
+		if _, set := merged[key]; !set {
+			setAtMap(&merged, key, value)
+		}
+	}
+	return merged
+}
+
+// selectorFor builds the selector for a workload, taken from the explicit selector when one was set and
+// from the pod template labels otherwise.
+func selectorFor(explicit, podLabels map[string]string) *meta_v1.LabelSelector {
+	source := explicit
+	if len(source) == 0 {
+		source = podLabels
+	}
+	if len(source) == 0 {
+		return nil
+	}
+
+	matchLabels := make(map[string]string)
+	for key, value := range source {
+		matchLabels[key] = value
+	}
+	return &meta_v1.LabelSelector{MatchLabels: matchLabels}
+}
+
+func validateSelector(selector *meta_v1.LabelSelector, podLabels map[string]string) (err error) {
+	if selector == nil {
+		return errors.New("workload has no selector, add labels to the pod or set one explicitly")
+	}
+	parsed, err := meta_v1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return errors.Wrapf(err, "invalid selector")
+	}
+	if !parsed.Matches(labels.Set(podLabels)) {
+		return errors.Errorf("selector %s does not match pod template labels %v", parsed, podLabels)
+	}
+	return
+}
+
+func selectorsEqual(a, b *meta_v1.LabelSelector) bool {
+	var empty meta_v1.LabelSelector
+	if a == nil {
+		a = &empty
+	}
+	if b == nil {
+		b = &empty
+	}
+	if len(a.MatchLabels) != len(b.MatchLabels) || len(a.MatchExpressions) != len(b.MatchExpressions) {
+		return false
+	}
+	return (len(a.MatchLabels) == 0 || reflect.DeepEqual(a.MatchLabels, b.MatchLabels)) &&
+		(len(a.MatchExpressions) == 0 || reflect.DeepEqual(a.MatchExpressions, b.MatchExpressions))
+}
+
+// selectorImmutable is an objectClient.immutable check for workloads whose selector can't change.
+func selectorImmutable(selectorOf func(runtime.Object) *meta_v1.LabelSelector) func(live, desired runtime.Object) error {
+	return func(live, desired runtime.Object) error {
+		liveSelector, desiredSelector := selectorOf(live), selectorOf(desired)
+		if desiredSelector == nil || selectorsEqual(liveSelector, desiredSelector) {
+			return nil
+		}
+		return errors.Errorf("selector can't be changed from %v to %v", liveSelector, desiredSelector)
+	}
+}
+
+// recreate deletes the live object and creates desired in its place, for changes the server won't
+// accept as an update.
+func (client objectClient) recreate(name string, desired runtime.Object, mode dryRunMode) (result PushResult, err error) {
+	result.Operation = OperationRecreated
+	result.DryRun = mode != dryRunNone
+	if mode != dryRunNone {
+		result.Object = desired
+		return
+	}
+
+	// foreground deletion keeps the object around until its dependents, such as the pods of a workload,
+	// are gone, so the replacement never runs next to them
+	propagation := meta_v1.DeletePropagationForeground
+	err = client.delete(name, &meta_v1.DeleteOptions{PropagationPolicy: &propagation})
+	if err != nil && !kube_errors.IsNotFound(err) {
+		err = errors.Wrapf(err, "failed to delete %s %s", client.kind, name)
+		return
+	}
+
+	err = wait.Poll(recreatePollInterval, recreateTimeout, func() (bool, error) {
+		_, err := client.get(name)
+		if kube_errors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	})
+	if err != nil {
+		err = errors.Wrapf(err, "waiting for %s %s to be deleted", client.kind, name)
+		return
+	}
+
+	result.Object, err = client.create(desired)
+	if err != nil {
+		err = errors.Wrapf(err, "failed to create %s %s", client.kind, name)
+	}
+	return
+}
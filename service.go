@@ -1,14 +1,33 @@
 package kube_builders
 
 import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+
 	"github.com/pkg/errors"
-	kube_errors "k8s.io/apimachinery/pkg/api/errors"
 	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/pkg/api/v1"
 )
 
+// the longest session affinity timeout the server accepts, a day
+const maxAffinityTimeout = 86400
+
+const (
+	// the annotation this API version reads instead of a publishNotReadyAddresses field
+	tolerateUnreadyAnnotation = "service.alpha.kubernetes.io/tolerate-unready-endpoints"
+
+	// the app protocol of each port by name, as JSON, which ingress controllers read since this API
+	// version has no appProtocol field on ports
+	appProtocolsAnnotation = "service.alpha.kubernetes.io/app-protocols"
+)
+
 type ServiceBuilder struct {
 	kube *KubeTarget
 
@@ -18,20 +37,53 @@ type ServiceBuilder struct {
 	sType    v1.ServiceType
 	selector map[string]string
 
+	headless            bool
+	publishNotReady     bool
+	externalName        string
+	sourceRanges        []string
+	externalTraffic     v1.ServiceExternalTrafficPolicyType
+	healthCheckNodePort int
+	sessionAffinity     v1.ServiceAffinity
+	loadBalancerClass   string
+	affinityTimeout     int64
+
 	labels      map[string]string
 	annotations map[string]string
-	ports       map[string]portSpec
+	ports       []portSpec
+	sorted      bool
 }
 
+// portSpec is one port of a service.
 type portSpec struct {
-	target intstr.IntOrString
-	port   int
+	name        string
+	target      intstr.IntOrString
+	port        int
+	protocol    v1.Protocol
+	nodePort    int
+	appProtocol string
 }
 
 func (kube *KubeTarget) Service(name, namespace string) ServiceBuilder {
 	return ServiceBuilder{kube: kube, name: name, namespace: namespace}
 }
 
+// workloadService starts a service for the pods of a workload: it selects them the way the workload
+// does and exposes every named container port under the same name. Unnamed ports are left out.
+func (kube *KubeTarget) workloadService(name, namespace string, selector *meta_v1.LabelSelector, pod v1.PodSpec) (svc ServiceBuilder) {
+	svc = kube.Service(name, namespace)
+	if selector != nil {
+		svc.selector = copyMap(selector.MatchLabels)
+	}
+	for _, container := range pod.Containers {
+		for _, port := range container.Ports {
+			if len(port.Name) > 0 {
+				svc = svc.PortByName(port.Name, port.Name, int(port.ContainerPort)).PortProtocol(port.Name, port.Protocol)
+			}
+		}
+	}
+	return
+}
+
 func (svc ServiceBuilder) Type(sType v1.ServiceType) ServiceBuilder {
 	svc.sType = sType
 	return svc
@@ -53,54 +105,408 @@ func (svc ServiceBuilder) Annotation(annotation string, value interface{}) Servi
 }
 
 func (svc ServiceBuilder) PortByNumber(name string, target, port int) ServiceBuilder {
-	setAtMapDirect(&svc.ports, name, portSpec{port: port, target: intstr.FromInt(target)})
+	svc.ports = svc.setPort(portSpec{name: name, port: port, target: intstr.FromInt(target)})
 	return svc
 }
 
 func (svc ServiceBuilder) PortByName(name, target string, port int) ServiceBuilder {
-	setAtMapDirect(&svc.ports, name, portSpec{port: port, target: intstr.FromString(target)})
+	svc.ports = svc.setPort(portSpec{name: name, port: port, target: intstr.FromString(target)})
+	return svc
+}
+
+// Headless gives the service no cluster IP, so its DNS name resolves to the addresses of its pods.
+func (svc ServiceBuilder) Headless() ServiceBuilder {
+	svc.headless = true
+	return svc
+}
+
+// PublishNotReadyAddresses includes pods which aren't ready in DNS, which is mostly useful for headless
+// services of stateful peers discovering each other. This API version only supports it through the
+// tolerate-unready-endpoints annotation.
+func (svc ServiceBuilder) PublishNotReadyAddresses() ServiceBuilder {
+	svc.publishNotReady = true
 	return svc
 }
 
+// ExternalName makes the service a DNS alias of host instead of selecting pods.
+func (svc ServiceBuilder) ExternalName(host string) ServiceBuilder {
+	svc.sType = v1.ServiceTypeExternalName
+	svc.externalName = host
+	return svc
+}
+
+// LoadBalancerSourceRanges limits the clients of a LoadBalancer service to the given CIDRs, on cloud
+// providers which support it.
+func (svc ServiceBuilder) LoadBalancerSourceRanges(cidrs ...string) ServiceBuilder {
+	svc.sourceRanges = append(append([]string(nil), svc.sourceRanges...), cidrs...)
+	return svc
+}
+
+// ExternalTrafficPolicy sets whether external traffic is only routed to pods on the node it arrived at,
+// which keeps client source IPs, or spread over the cluster.
+func (svc ServiceBuilder) ExternalTrafficPolicy(policy v1.ServiceExternalTrafficPolicyType) ServiceBuilder {
+	svc.externalTraffic = policy
+	return svc
+}
+
+// HealthCheckNodePort fixes the node port load balancers health check when the external traffic policy
+// is Local.
+func (svc ServiceBuilder) HealthCheckNodePort(port int) ServiceBuilder {
+	svc.healthCheckNodePort = port
+	return svc
+}
+
+// LoadBalancerClass picks the load balancer implementation of a LoadBalancer service, instead of the
+// default one of the cloud provider. Our typed client predates the field, so a service with a class is
+// pushed through the dynamic client of the target, and AsKube leaves it off.
+func (svc ServiceBuilder) LoadBalancerClass(class string) ServiceBuilder {
+	svc.loadBalancerClass = class
+	return svc
+}
+
+// SessionAffinity routes every connection of a client to the same pod when set to ClientIP.
+func (svc ServiceBuilder) SessionAffinity(affinity v1.ServiceAffinity) ServiceBuilder {
+	svc.sessionAffinity = affinity
+	return svc
+}
+
+// SessionAffinityTimeout routes every connection of a client to the same pod until it has been idle for
+// seconds, instead of the default of 3 hours. Our typed client predates the field, so the service is
+// pushed through the dynamic client of the target, and AsKube leaves it off.
+func (svc ServiceBuilder) SessionAffinityTimeout(seconds int) ServiceBuilder {
+	svc.sessionAffinity = v1.ServiceAffinityClientIP
+	svc.affinityTimeout = int64(seconds)
+	return svc
+}
+
+// PortProtocol sets the protocol of the port added under name, which is TCP by default.
+func (svc ServiceBuilder) PortProtocol(name string, protocol v1.Protocol) ServiceBuilder {
+	port := svc.port(name)
+	port.protocol = protocol
+	svc.ports = svc.setPort(port)
+	return svc
+}
+
+// NodePort fixes the node port of the port added under name instead of letting the cluster allocate one.
+// The service must be of type NodePort or LoadBalancer.
+func (svc ServiceBuilder) NodePort(name string, nodePort int) ServiceBuilder {
+	port := svc.port(name)
+	port.nodePort = nodePort
+	svc.ports = svc.setPort(port)
+	return svc
+}
+
+// AppProtocol sets the application protocol of the port added under name, such as HTTPS or HTTP2, for
+// load balancers and ingress controllers talking to it. ServicePort has no appProtocol field in this API
+// version, so it is set in the service.alpha.kubernetes.io/app-protocols annotation, which needs the
+// port to be named.
+func (svc ServiceBuilder) AppProtocol(name, appProtocol string) ServiceBuilder {
+	port := svc.port(name)
+	port.appProtocol = appProtocol
+	svc.ports = svc.setPort(port)
+	return svc
+}
+
+// port returns the port added under name, and panics when there is none.
+func (svc ServiceBuilder) port(name string) portSpec {
+	for _, port := range svc.ports {
+		if port.name == name {
+			return port
+		}
+	}
+	panic(fmt.Sprintf("service %s has no port named %q", svc.name, name))
+}
+
+// Sorted orders ports by name instead of the order they were added in.
+func (svc ServiceBuilder) Sorted() ServiceBuilder {
+	svc.sorted = true
+	return svc
+}
+
+// setPort returns the ports with the one of the same name replaced, or added. The slice is copied as
+// other copies of the builder may share it.
+func (svc ServiceBuilder) setPort(port portSpec) []portSpec {
+	ports := append([]portSpec(nil), svc.ports...)
+	for i := range ports {
+		if ports[i].name == port.name {
+			ports[i] = port
+			return ports
+		}
+	}
+	return append(ports, port)
+}
+
 func (svc ServiceBuilder) AsKube() (kubeSvc *v1.Service) {
 	kubeSvc = new(v1.Service)
+	kubeSvc.TypeMeta = meta_v1.TypeMeta{Kind: "Service", APIVersion: v1.SchemeGroupVersion.String()}
 	kubeSvc.Name = svc.name
 	kubeSvc.Namespace = svc.namespace
 	kubeSvc.Annotations = svc.annotations
 	kubeSvc.Labels = svc.labels
+	svc.kube.stampProvenance(&kubeSvc.ObjectMeta)
 	kubeSvc.Spec.Type = svc.sType
 	kubeSvc.Spec.Selector = svc.selector
-	if svc.ports != nil {
-		for portName, port := range svc.ports {
-			kubeSvc.Spec.Ports = append(kubeSvc.Spec.Ports, v1.ServicePort{Name: portName, TargetPort: port.target, Port: int32(port.port)})
-		}
+	if svc.headless {
+		kubeSvc.Spec.ClusterIP = v1.ClusterIPNone
+	}
+	if svc.publishNotReady {
+		kubeSvc.Annotations = copyMap(kubeSvc.Annotations)
+		setAtMap(&kubeSvc.Annotations, tolerateUnreadyAnnotation, "true")
+	}
+	if appProtocols := svc.appProtocols(); len(appProtocols) > 0 {
+		kubeSvc.Annotations = copyMap(kubeSvc.Annotations)
+		setAtMap(&kubeSvc.Annotations, appProtocolsAnnotation, appProtocols)
+	}
+	kubeSvc.Spec.ExternalName = svc.externalName
+	kubeSvc.Spec.LoadBalancerSourceRanges = svc.sourceRanges
+	kubeSvc.Spec.ExternalTrafficPolicy = svc.externalTraffic
+	kubeSvc.Spec.HealthCheckNodePort = int32(svc.healthCheckNodePort)
+	kubeSvc.Spec.SessionAffinity = svc.sessionAffinity
+	for _, port := range svc.ports {
+		kubeSvc.Spec.Ports = append(kubeSvc.Spec.Ports, v1.ServicePort{
+			Name:       port.name,
+			TargetPort: port.target,
+			Port:       int32(port.port),
+			Protocol:   port.protocol,
+			NodePort:   int32(port.nodePort),
+		})
+	}
+	if svc.sorted {
+		sort.SliceStable(kubeSvc.Spec.Ports, func(i, j int) bool { return kubeSvc.Spec.Ports[i].Name < kubeSvc.Spec.Ports[j].Name })
 	}
 	return
 }
 
-func (svc ServiceBuilder) Push() (kubeSvc *v1.Service, err error) {
-	kubeSvc = svc.AsKube()
-	err = PushService(kubeSvc, svc.kube.iface)
+// appProtocols encodes the app protocols of the ports for the app-protocols annotation, or returns an
+// empty string when no port has one.
+func (svc ServiceBuilder) appProtocols() string {
+	protocols := make(map[string]string)
+	for _, port := range svc.ports {
+		if len(port.appProtocol) > 0 {
+			protocols[port.name] = port.appProtocol
+		}
+	}
+	if len(protocols) == 0 {
+		return ""
+	}
+	// a map of strings always encodes, with its keys sorted
+	encoded, _ := json.Marshal(protocols)
+	return string(encoded)
+}
+
+// validate catches services the server would reject, before anything is pushed.
+func (svc ServiceBuilder) validate(kubeSvc *v1.Service) (err error) {
+	if err = validateServicePorts(kubeSvc.Spec.Ports); err != nil {
+		return
+	}
+	spec := kubeSvc.Spec
+	onNodes := exposedOnNodes(spec.Type)
+	for _, port := range spec.Ports {
+		if port.NodePort != 0 && !onNodes {
+			return errors.Errorf("port %s has a node port, which needs a NodePort or LoadBalancer service", port.Name)
+		}
+	}
+	for _, port := range svc.ports {
+		if len(port.appProtocol) > 0 && len(port.name) == 0 {
+			return errors.Errorf("port %d needs a name to have an app protocol", port.port)
+		}
+	}
+
+	switch {
+	case spec.Type == v1.ServiceTypeExternalName && len(spec.ExternalName) == 0:
+		return errors.New("ExternalName service needs a host name")
+	case spec.Type == v1.ServiceTypeExternalName && len(spec.Selector) > 0:
+		return errors.New("ExternalName service can't have a selector")
+	case spec.Type == v1.ServiceTypeExternalName && spec.ClusterIP == v1.ClusterIPNone:
+		return errors.New("ExternalName service can't be headless")
+	case spec.Type != v1.ServiceTypeExternalName && len(spec.ExternalName) > 0:
+		return errors.Errorf("only ExternalName services can have an external name, not %s", spec.Type)
+	case spec.ClusterIP == v1.ClusterIPNone && onNodes:
+		return errors.Errorf("%s service can't be headless", spec.Type)
+	case len(spec.LoadBalancerSourceRanges) > 0 && spec.Type != v1.ServiceTypeLoadBalancer:
+		return errors.New("load balancer source ranges need a LoadBalancer service")
+	case len(spec.ExternalTrafficPolicy) > 0 && !onNodes:
+		return errors.New("external traffic policy needs a NodePort or LoadBalancer service")
+	case spec.HealthCheckNodePort != 0 && (spec.Type != v1.ServiceTypeLoadBalancer || spec.ExternalTrafficPolicy != v1.ServiceExternalTrafficPolicyTypeLocal):
+		return errors.New("health check node port needs a LoadBalancer service with the Local external traffic policy")
+	case len(svc.loadBalancerClass) > 0 && spec.Type != v1.ServiceTypeLoadBalancer:
+		return errors.New("load balancer class needs a LoadBalancer service")
+	case svc.affinityTimeout != 0 && spec.SessionAffinity != v1.ServiceAffinityClientIP:
+		return errors.New("session affinity timeout needs ClientIP session affinity")
+	case svc.affinityTimeout < 0 || svc.affinityTimeout > maxAffinityTimeout:
+		return errors.Errorf("session affinity timeout must be between 1 and %d seconds", maxAffinityTimeout)
+	}
+
+	for _, cidr := range spec.LoadBalancerSourceRanges {
+		if _, _, err = net.ParseCIDR(cidr); err != nil {
+			return errors.Wrapf(err, "invalid load balancer source range")
+		}
+	}
 	return
 }
 
-func PushService(kubeSvc *v1.Service, iface kubernetes.Interface) (err error) {
-	services := iface.CoreV1().Services(kubeSvc.Namespace)
-	svcFromKube, err := services.Get(kubeSvc.Name, meta_v1.GetOptions{})
-	var f func(*v1.Service) (*v1.Service, error)
-	if kube_errors.IsNotFound(err) {
-		f = services.Create
-	} else if err != nil {
+// build is the service as Render, Diff and Push produce it, failing on a service the server would
+// reject. It is unstructured when the service sets fields the typed client doesn't have.
+func (svc ServiceBuilder) build() (obj runtime.Object, err error) {
+	kubeSvc := svc.AsKube()
+	if err = svc.validate(kubeSvc); err != nil {
+		err = errors.Wrapf(err, "service %s", svc.name)
+		return
+	}
+	if newerSpec := svc.newerSpec(); newerSpec != nil {
+		return unstructuredService(kubeSvc, newerSpec)
+	}
+	return kubeSvc, nil
+}
+
+// client pushes the service through the typed client, or the dynamic one when it sets fields the typed
+// client doesn't have.
+func (svc ServiceBuilder) client() (objectClient, error) {
+	if newerSpec := svc.newerSpec(); newerSpec != nil {
+		return svc.unstructuredServiceClient(newerSpec)
+	}
+	return serviceClient(svc.namespace, svc.kube.iface), nil
+}
+
+func (svc ServiceBuilder) Render(w io.Writer, format Format) error {
+	obj, err := svc.build()
+	if err != nil {
+		return err
+	}
+	return Render(w, format, obj)
+}
+
+func (svc ServiceBuilder) Diff() (diff ObjectDiff, err error) {
+	obj, err := svc.build()
+	if err != nil {
+		return
+	}
+	client, err := svc.client()
+	if err != nil {
 		return
-	} else {
-		f = services.Update
-		svcFromKube.Spec.Ports = kubeSvc.Spec.Ports
-		svcFromKube.Spec.Type = kubeSvc.Spec.Type
-		kubeSvc = svcFromKube
 	}
-	_, err = f(kubeSvc)
+	return client.diff(obj)
+}
+
+// Push creates or updates the service. The returned service lacks the fields our typed client doesn't
+// have, such as the load balancer class, even when they were pushed.
+func (svc ServiceBuilder) Push() (kubeSvc *v1.Service, result PushResult, err error) {
+	kubeSvc = svc.AsKube()
+	obj, err := svc.build()
 	if err != nil {
-		err = errors.Wrapf(err, "creating service %s", kubeSvc.Name)
+		return
+	}
+	client, err := svc.client()
+	if err != nil {
+		return
+	}
+	result, err = client.push(obj, svc.kube.dryRun)
+	switch persisted := result.Object.(type) {
+	case *v1.Service:
+		kubeSvc = persisted
+	case *unstructured.Unstructured:
+		if typed, typedErr := typedService(persisted); typedErr == nil {
+			kubeSvc = typed
+		}
 	}
 	return
 }
+
+func PushService(kubeSvc *v1.Service, iface kubernetes.Interface) (result PushResult, err error) {
+	return serviceClient(kubeSvc.Namespace, iface).push(kubeSvc, dryRunNone)
+}
+
+func serviceClient(namespace string, iface kubernetes.Interface) objectClient {
+	services := iface.CoreV1().Services(namespace)
+	return objectClient{
+		kind:      "service",
+		resource:  "services",
+		namespace: namespace,
+		rest:      iface.CoreV1().RESTClient(),
+		newObject: func() runtime.Object { return new(v1.Service) },
+		get: func(name string) (runtime.Object, error) {
+			return services.Get(name, meta_v1.GetOptions{})
+		},
+		create: func(obj runtime.Object) (runtime.Object, error) {
+			return services.Create(obj.(*v1.Service))
+		},
+		update: func(obj runtime.Object) (runtime.Object, error) {
+			return services.Update(obj.(*v1.Service))
+		},
+		delete:    services.Delete,
+		immutable: serviceImmutable,
+		prepare:   prepareService,
+	}
+}
+
+// prepareService updates the live service with every field the builder owns. The cluster IP and node
+// ports allocated by the server are kept, unless the new type doesn't use them.
+func prepareService(live, desired runtime.Object) (runtime.Object, error) {
+	liveSvc, desiredSvc := live.(*v1.Service), desired.(*v1.Service)
+
+	next := *liveSvc
+	next.Labels = desiredSvc.Labels
+	next.Annotations = desiredSvc.Annotations
+	next.Spec = desiredSvc.Spec
+
+	if len(next.Spec.Type) == 0 && len(liveSvc.Spec.Type) > 0 {
+		// spelled out so leaving another type shows up as a change, an empty field is never compared
+		next.Spec.Type = v1.ServiceTypeClusterIP
+	}
+	switch {
+	case next.Spec.Type == v1.ServiceTypeExternalName:
+		// an external name service has no cluster IP, and one left over from another type is rejected
+		next.Spec.ClusterIP = ""
+	case len(next.Spec.ClusterIP) == 0:
+		next.Spec.ClusterIP = liveSvc.Spec.ClusterIP
+	}
+
+	next.Spec.Ports = append([]v1.ServicePort(nil), desiredSvc.Spec.Ports...)
+	if exposedOnNodes(next.Spec.Type) && exposedOnNodes(liveSvc.Spec.Type) {
+		for i := range next.Spec.Ports {
+			if next.Spec.Ports[i].NodePort == 0 {
+				next.Spec.Ports[i].NodePort = allocatedNodePort(liveSvc.Spec.Ports, next.Spec.Ports[i])
+			}
+		}
+	}
+
+	if next.Spec.HealthCheckNodePort == 0 && next.Spec.Type == v1.ServiceTypeLoadBalancer &&
+		next.Spec.ExternalTrafficPolicy == v1.ServiceExternalTrafficPolicyTypeLocal {
+		next.Spec.HealthCheckNodePort = liveSvc.Spec.HealthCheckNodePort
+	}
+	return &next, nil
+}
+
+// allocatedNodePort finds the node port the server gave to a port, matched by name and then by port and
+// protocol.
+func allocatedNodePort(live []v1.ServicePort, port v1.ServicePort) int32 {
+	for _, livePort := range live {
+		if livePort.Name == port.Name {
+			return livePort.NodePort
+		}
+	}
+	for _, livePort := range live {
+		if newPortKey(livePort.Port, livePort.Protocol) == newPortKey(port.Port, port.Protocol) {
+			return livePort.NodePort
+		}
+	}
+	return 0
+}
+
+// serviceImmutable rejects switching a service between headless and having a cluster IP, which the
+// server doesn't allow without deleting it.
+func serviceImmutable(live, desired runtime.Object) error {
+	liveSpec, desiredSpec := live.(*v1.Service).Spec, desired.(*v1.Service).Spec
+	if liveSpec.Type == v1.ServiceTypeExternalName || desiredSpec.Type == v1.ServiceTypeExternalName {
+		return nil
+	}
+	liveHeadless, desiredHeadless := liveSpec.ClusterIP == v1.ClusterIPNone, desiredSpec.ClusterIP == v1.ClusterIPNone
+	if liveHeadless != desiredHeadless {
+		return errors.Errorf("cluster IP can't be changed from %q to %q", liveSpec.ClusterIP, desiredSpec.ClusterIP)
+	}
+	return nil
+}
+
+func exposedOnNodes(sType v1.ServiceType) bool {
+	return sType == v1.ServiceTypeNodePort || sType == v1.ServiceTypeLoadBalancer
+}
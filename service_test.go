@@ -1,12 +1,16 @@
 package kube_builders_test
 
 import (
+	"bytes"
+
 	. "github.com/Twister915/kube_builders"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/pkg/api/v1"
 )
 
 var _ = Describe("Service", func() {
@@ -44,7 +48,174 @@ var _ = Describe("Service", func() {
 		Expect(p.Port).To(BeEquivalentTo(port))
 
 		By("deploying it to kubernetes")
-		_, err := svc.Push()
+		_, _, err := svc.Push()
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("keeps ports in the order they were added", func() {
+		svc := kubeTarget.Service(serviceName, serviceNamespace).PortByNumber("web", 80, 80).PortByNumber("admin", 81, 81)
+		ports := svc.AsKube().Spec.Ports
+		Expect(ports[0].Name).To(Equal("web"))
+		Expect(ports[1].Name).To(Equal("admin"))
+
+		ports = svc.Sorted().AsKube().Spec.Ports
+		Expect(ports[0].Name).To(Equal("admin"))
+		Expect(ports[1].Name).To(Equal("web"))
+	})
+
+	It("derives a service from a workload", func() {
+		deployment := kubeTarget.NewPod("", serviceNamespace).Label(selectorKey, selectorValue).Container("web", "image", func(ctr ContainerBuilder) ContainerBuilder {
+			return ctr.Port(8080, portName).Port(9090, "metrics").Port(7000, "")
+		}).Deployment(serviceName)
+
+		svc := deployment.Service(serviceName)
+		service := svc.AsKube()
+		Expect(service.Spec.Selector).To(Equal(map[string]string{selectorKey: selectorValue}))
+		Expect(service.Spec.Ports).To(HaveLen(2))
+		Expect(service.Spec.Ports[0].Name).To(Equal(portName))
+		Expect(service.Spec.Ports[0].Port).To(BeEquivalentTo(8080))
+		Expect(service.Spec.Ports[0].TargetPort.String()).To(Equal(portName))
+
+		By("allowing the ports to be overridden")
+		overridden := svc.PortByName(portName, portName, port).AsKube()
+		Expect(overridden.Spec.Ports[0].Port).To(BeEquivalentTo(port))
+		Expect(svc.AsKube().Spec.Ports[0].Port).To(BeEquivalentTo(8080))
+
+		By("selecting daemon set pods the same way")
+		daemonSvc := kubeTarget.NewPod("", serviceNamespace).Container("web", "image", func(ctr ContainerBuilder) ContainerBuilder {
+			return ctr.Port(8080, portName)
+		}).DaemonSet(serviceName).Service(serviceName).AsKube()
+		Expect(daemonSvc.Spec.Selector).To(Equal(map[string]string{"app": serviceName}))
+	})
+
+	It("builds headless and external name services", func() {
+		headless := kubeTarget.Service(serviceName, serviceNamespace).Selector(selectorKey, selectorValue).Headless().PublishNotReadyAddresses().AsKube()
+		Expect(headless.Spec.ClusterIP).To(Equal("None"))
+		Expect(headless.Annotations).To(HaveKeyWithValue("service.alpha.kubernetes.io/tolerate-unready-endpoints", "true"))
+
+		external, _, err := kubeTarget.Service(serviceName, serviceNamespace).ExternalName("db.example.com").Push()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(external.Spec.Type).To(Equal(v1.ServiceTypeExternalName))
+		Expect(external.Spec.ExternalName).To(Equal("db.example.com"))
+	})
+
+	It("configures load balancers", func() {
+		svc, _, err := kubeTarget.Service(serviceName, serviceNamespace).Selector(selectorKey, selectorValue).PortByNumber(portName, port, port).
+			Type(v1.ServiceTypeLoadBalancer).
+			LoadBalancerSourceRanges("10.0.0.0/8", "192.168.0.0/16").
+			ExternalTrafficPolicy(v1.ServiceExternalTrafficPolicyTypeLocal).
+			HealthCheckNodePort(30100).
+			SessionAffinity(v1.ServiceAffinityClientIP).
+			Push()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(svc.Spec.LoadBalancerSourceRanges).To(Equal([]string{"10.0.0.0/8", "192.168.0.0/16"}))
+		Expect(svc.Spec.ExternalTrafficPolicy).To(Equal(v1.ServiceExternalTrafficPolicyTypeLocal))
+		Expect(svc.Spec.HealthCheckNodePort).To(BeEquivalentTo(30100))
+		Expect(svc.Spec.SessionAffinity).To(Equal(v1.ServiceAffinityClientIP))
+	})
+
+	It("configures fields newer than the typed client", func() {
+		svc := kubeTarget.Service(serviceName, serviceNamespace).Selector(selectorKey, selectorValue).PortByNumber(portName, port, port).
+			Type(v1.ServiceTypeLoadBalancer).
+			LoadBalancerClass("example.com/internal").
+			SessionAffinityTimeout(600)
+
+		var rendered bytes.Buffer
+		Expect(svc.Render(&rendered, FormatYAML)).To(Succeed())
+		Expect(rendered.String()).To(ContainSubstring("loadBalancerClass: example.com/internal"))
+		Expect(rendered.String()).To(ContainSubstring("sessionAffinity: ClientIP"))
+		Expect(rendered.String()).To(ContainSubstring("timeoutSeconds: 600"))
+
+		By("pushing them through the dynamic client")
+		_, _, err := svc.Push()
+		Expect(err).To(MatchError(ContainSubstring("no dynamic client")))
+	})
+
+	It("rejects illegal combinations before pushing", func() {
+		svc := kubeTarget.Service(serviceName, serviceNamespace)
+		invalid := []ServiceBuilder{
+			svc.ExternalName("db.example.com").Selector(selectorKey, selectorValue),
+			svc.ExternalName("db.example.com").Headless(),
+			svc.Type(v1.ServiceTypeNodePort).Headless(),
+			svc.LoadBalancerSourceRanges("10.0.0.0/8"),
+			svc.Type(v1.ServiceTypeLoadBalancer).LoadBalancerSourceRanges("not a cidr"),
+			svc.ExternalTrafficPolicy(v1.ServiceExternalTrafficPolicyTypeLocal),
+			svc.Type(v1.ServiceTypeLoadBalancer).HealthCheckNodePort(30100),
+			svc.LoadBalancerClass("example.com/internal"),
+			svc.SessionAffinityTimeout(100000),
+			svc.SessionAffinityTimeout(600).SessionAffinity(v1.ServiceAffinityNone),
+		}
+		for _, builder := range invalid {
+			_, _, err := builder.Push()
+			Expect(err).To(HaveOccurred())
+		}
+		_, err := fakeKubernetes.CoreV1().Services(serviceNamespace).Get(serviceName, meta_v1.GetOptions{})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("reconciles selector, labels and annotations", func() {
+		svc := kubeTarget.Service(serviceName, serviceNamespace).Selector(selectorKey, selectorValue).PortByNumber(portName, port, port)
+		_, _, err := svc.Push()
+		Expect(err).ToNot(HaveOccurred())
+
+		_, result, err := svc.Selector(selectorKey, "other-app").Label("team", "web").Annotation("owner", "me").Push()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Operation).To(Equal(OperationUpdated))
+
+		live, err := fakeKubernetes.CoreV1().Services(serviceNamespace).Get(serviceName, meta_v1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(live.Spec.Selector).To(HaveKeyWithValue(selectorKey, "other-app"))
+		Expect(live.Labels).To(HaveKeyWithValue("team", "web"))
+		Expect(live.Annotations).To(HaveKeyWithValue("owner", "me"))
+	})
+
+	It("removes selector keys, labels and annotations the builder no longer sets", func() {
+		base := func() ServiceBuilder {
+			return kubeTarget.Service(serviceName, serviceNamespace).Selector(selectorKey, selectorValue).PortByNumber(portName, port, port)
+		}
+		_, _, err := base().Selector("tier", "web").Label("team", "web").Annotation("owner", "me").Push()
+		Expect(err).ToNot(HaveOccurred())
+
+		_, result, err := base().Push()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Operation).To(Equal(OperationUpdated))
+
+		live, err := fakeKubernetes.CoreV1().Services(serviceNamespace).Get(serviceName, meta_v1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(live.Spec.Selector).To(Equal(map[string]string{selectorKey: selectorValue}))
+		Expect(live.Labels).ToNot(HaveKey("team"))
+		Expect(live.Annotations).ToNot(HaveKey("owner"))
+	})
+
+	It("keeps allocated addresses and clears node ports when leaving NodePort", func() {
+		svc := kubeTarget.Service(serviceName, serviceNamespace).Selector(selectorKey, selectorValue).PortByNumber(portName, port, port)
+		created, _, err := svc.Type(v1.ServiceTypeNodePort).Push()
+		Expect(err).ToNot(HaveOccurred())
+
+		By("pretending the server allocated a cluster IP and node port")
+		created.Spec.ClusterIP = "10.0.0.10"
+		created.Spec.Ports[0].NodePort = 30080
+		_, err = fakeKubernetes.CoreV1().Services(serviceNamespace).Update(created)
+		Expect(err).ToNot(HaveOccurred())
+
+		updated, _, err := svc.Type(v1.ServiceTypeNodePort).Label("team", "web").Push()
 		Expect(err).ToNot(HaveOccurred())
+		Expect(updated.Spec.ClusterIP).To(Equal("10.0.0.10"))
+		Expect(updated.Spec.Ports[0].NodePort).To(BeEquivalentTo(30080))
+
+		updated, _, err = svc.Push()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(updated.Spec.Type).To(Equal(v1.ServiceTypeClusterIP))
+		Expect(updated.Spec.ClusterIP).To(Equal("10.0.0.10"))
+		Expect(updated.Spec.Ports[0].NodePort).To(BeZero())
+	})
+
+	It("refuses to make an existing service headless", func() {
+		svc := kubeTarget.Service(serviceName, serviceNamespace).Selector(selectorKey, selectorValue)
+		_, _, err := svc.Push()
+		Expect(err).ToNot(HaveOccurred())
+
+		_, _, err = svc.Headless().Push()
+		Expect(err).To(MatchError(ContainSubstring("cluster IP can't be changed")))
 	})
 })
@@ -0,0 +1,160 @@
+package kube_builders
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+// Services using fields newer than our typed client, such as a load balancer class, are pushed as
+// unstructured objects through the dynamic client. Everything the typed client knows is still built and
+// reconciled the typed way.
+
+var serviceKind = schema.GroupVersionKind{Version: "v1", Kind: "Service"}
+
+// spec fields of a service the builder sets which the typed client doesn't have
+var newerServiceFields = []string{"loadBalancerClass", "sessionAffinityConfig"}
+
+// typedServiceFields are the spec fields of a service the typed client knows, by their JSON name.
+var typedServiceFields = jsonFieldNames(reflect.TypeOf(v1.ServiceSpec{}))
+
+// newerSpec returns the spec fields of the service the typed client doesn't have, or nil when none are
+// set.
+func (svc ServiceBuilder) newerSpec() (spec map[string]interface{}) {
+	if len(svc.loadBalancerClass) > 0 {
+		spec = map[string]interface{}{"loadBalancerClass": svc.loadBalancerClass}
+	}
+	if svc.affinityTimeout > 0 {
+		if spec == nil {
+			spec = make(map[string]interface{})
+		}
+		spec["sessionAffinityConfig"] = map[string]interface{}{
+			"clientIP": map[string]interface{}{"timeoutSeconds": svc.affinityTimeout},
+		}
+	}
+	return
+}
+
+// unstructuredService converts a typed service into an unstructured one with the newer spec fields
+// added.
+func unstructuredService(kubeSvc *v1.Service, newerSpec map[string]interface{}) (obj *unstructured.Unstructured, err error) {
+	data, err := json.Marshal(kubeSvc)
+	if err != nil {
+		return nil, errors.Wrapf(err, "encoding service %s", kubeSvc.Name)
+	}
+	obj = new(unstructured.Unstructured)
+	if err = obj.UnmarshalJSON(data); err != nil {
+		return nil, errors.Wrapf(err, "decoding service %s", kubeSvc.Name)
+	}
+	spec, _ := obj.Object["spec"].(map[string]interface{})
+	if spec == nil {
+		spec = make(map[string]interface{})
+		obj.Object["spec"] = spec
+	}
+	for key, value := range newerSpec {
+		spec[key] = value
+	}
+	return
+}
+
+// typedService converts an unstructured service into a typed one, dropping the fields the typed client
+// doesn't have.
+func typedService(obj runtime.Object) (kubeSvc *v1.Service, err error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return
+	}
+	kubeSvc = new(v1.Service)
+	err = json.Unmarshal(data, kubeSvc)
+	return
+}
+
+// unstructuredServiceClient pushes services through the dynamic client, with newerSpec as the fields
+// the typed client doesn't have.
+func (svc ServiceBuilder) unstructuredServiceClient(newerSpec map[string]interface{}) (client objectClient, err error) {
+	client, err = svc.kube.dynamicClient(serviceKind, "service", "services", svc.namespace)
+	if err != nil {
+		return
+	}
+	client.immutable = func(live, desired runtime.Object) (err error) {
+		liveSvc, err := typedService(live)
+		if err != nil {
+			return
+		}
+		desiredSvc, err := typedService(desired)
+		if err != nil {
+			return
+		}
+		return serviceImmutable(liveSvc, desiredSvc)
+	}
+	client.prepare = func(live, desired runtime.Object) (runtime.Object, error) {
+		return prepareUnstructuredService(live.(*unstructured.Unstructured), desired, newerSpec)
+	}
+	return
+}
+
+// prepareUnstructuredService updates the live service like prepareService does. Spec fields neither the
+// typed client nor the builder know about, such as the cluster IPs a dual stack server fills in, are
+// kept as they are live.
+func prepareUnstructuredService(live *unstructured.Unstructured, desired runtime.Object, newerSpec map[string]interface{}) (next runtime.Object, err error) {
+	liveSvc, err := typedService(live)
+	if err != nil {
+		return
+	}
+	desiredSvc, err := typedService(desired)
+	if err != nil {
+		return
+	}
+	prepared, err := prepareService(liveSvc, desiredSvc)
+	if err != nil {
+		return
+	}
+	// spelled out like the server would, so an unchanged service compares equal to the live one
+	if prepared, err = withServerDefaults(prepared); err != nil {
+		return
+	}
+	preparedObj, err := unstructuredService(prepared.(*v1.Service), newerSpec)
+	if err != nil {
+		return
+	}
+	if next, err = prepareUnstructured(live, preparedObj); err != nil {
+		return
+	}
+
+	spec := next.(*unstructured.Unstructured).Object["spec"].(map[string]interface{})
+	liveSpec, _ := live.Object["spec"].(map[string]interface{})
+	for key, value := range liveSpec {
+		if _, set := spec[key]; set || typedServiceFields[key] || isNewerServiceField(key) {
+			continue
+		}
+		spec[key] = value
+	}
+	return
+}
+
+func isNewerServiceField(key string) bool {
+	for _, field := range newerServiceFields {
+		if field == key {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonFieldNames returns the JSON names of the fields of a struct type.
+func jsonFieldNames(structType reflect.Type) map[string]bool {
+	names := make(map[string]bool)
+	for i := 0; i < structType.NumField(); i++ {
+		name := strings.Split(structType.Field(i).Tag.Get("json"), ",")[0]
+		if len(name) > 0 && name != "-" {
+			names[name] = true
+		}
+	}
+	return names
+}
@@ -0,0 +1,119 @@
+package kube_builders_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+
+	. "github.com/Twister915/kube_builders"
+
+	. "github.com/onsi/gomega"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// built fails the spec when an object couldn't be built
+func built(obj *unstructured.Unstructured, err error) *unstructured.Unstructured {
+	Expect(err).ToNot(HaveOccurred())
+	return obj
+}
+
+// field walks an unstructured object, indexing maps by string and slices by int
+func field(obj interface{}, path ...interface{}) interface{} {
+	for _, key := range path {
+		switch key := key.(type) {
+		case string:
+			obj = obj.(map[string]interface{})[key]
+		case int:
+			obj = obj.([]interface{})[key]
+		}
+	}
+	return obj
+}
+
+// apiServer is an in-memory API server for the dynamic client, storing objects under their URL path.
+type apiServer struct {
+	*httptest.Server
+
+	// defaults fills in fields of a created or updated object, like a real server would
+	defaults func(obj map[string]interface{})
+
+	lock     sync.Mutex
+	objects  map[string]map[string]interface{}
+	requests map[string]int
+}
+
+func newAPIServer() *apiServer {
+	server := &apiServer{objects: make(map[string]map[string]interface{}), requests: make(map[string]int)}
+	server.Server = httptest.NewServer(http.HandlerFunc(server.serve))
+	return server
+}
+
+// target returns a target pushing through the dynamic client of the server.
+func (server *apiServer) target(iface kubernetes.Interface) *KubeTarget {
+	return NewKubeTarget(iface).WithDynamicClient(dynamic.NewDynamicClientPool(&rest.Config{Host: server.URL}))
+}
+
+// object returns the object stored under path, or nil.
+func (server *apiServer) object(path string) map[string]interface{} {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	return server.objects[path]
+}
+
+// count returns how many requests were made with method.
+func (server *apiServer) count(method string) int {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	return server.requests[method]
+}
+
+func (server *apiServer) serve(w http.ResponseWriter, r *http.Request) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	server.requests[r.Method]++
+
+	w.Header().Set("Content-Type", "application/json")
+	path := r.URL.Path
+	switch r.Method {
+	case http.MethodGet:
+		obj, ok := server.objects[path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(meta_v1.Status{
+				TypeMeta: meta_v1.TypeMeta{Kind: "Status", APIVersion: "v1"},
+				Status:   meta_v1.StatusFailure,
+				Reason:   meta_v1.StatusReasonNotFound,
+				Code:     http.StatusNotFound,
+			})
+			return
+		}
+		json.NewEncoder(w).Encode(obj)
+	case http.MethodPost, http.MethodPut:
+		var obj map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&obj); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		metadata := obj["metadata"].(map[string]interface{})
+		if r.Method == http.MethodPost {
+			path += "/" + metadata["name"].(string)
+		}
+		if server.defaults != nil {
+			server.defaults(obj)
+		}
+		metadata["resourceVersion"] = strconv.Itoa(server.requests[http.MethodPost] + server.requests[http.MethodPut])
+		server.objects[path] = obj
+		if r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusCreated)
+		}
+		json.NewEncoder(w).Encode(obj)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
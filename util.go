@@ -2,7 +2,11 @@ package kube_builders
 
 import (
 	"fmt"
-	"reflect"
+	"strconv"
+	"strings"
+
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 func setAtMap(target *map[string]string, key string, value interface{}) {
@@ -12,10 +16,45 @@ func setAtMap(target *map[string]string, key string, value interface{}) {
 	(*target)[key] = fmt.Sprintf("%v", value)
 }
 
-func setAtMapDirect(target, key, value interface{}) {
-	rTarget := reflect.ValueOf(target)
-	if rTarget.Elem().IsNil() {
-		rTarget.Elem().Set(reflect.MakeMap(rTarget.Type().Elem()))
+func copyMap(source map[string]string) (copied map[string]string) {
+	if source == nil {
+		return
+	}
+	copied = make(map[string]string)
+	for key, value := range source {
+		copied[key] = value
+	}
+	return
+}
+
+// keepAnnotations carries annotations set on the live object by the server or a controller over to the
+// desired object, unless desired sets them itself. The annotations of desired are copied before they are
+// changed, as they usually still belong to a builder.
+func keepAnnotations(live, desired *meta_v1.ObjectMeta, keys ...string) {
+	for _, key := range keys {
+		value, ok := live.Annotations[key]
+		if !ok {
+			continue
+		}
+		if _, set := desired.Annotations[key]; set {
+			continue
+		}
+		desired.Annotations = copyMap(desired.Annotations)
+		setAtMap(&desired.Annotations, key, value)
 	}
-	rTarget.Elem().SetMapIndex(reflect.ValueOf(key), reflect.ValueOf(value))
-}
\ No newline at end of file
+}
+
+// intOrPercent converts an int or a percentage such as "25%" into an IntOrString.
+func intOrPercent(value interface{}) intstr.IntOrString {
+	switch typed := value.(type) {
+	case int:
+		return intstr.FromInt(typed)
+	case string:
+		if _, err := strconv.Atoi(strings.TrimSuffix(typed, "%")); err == nil && strings.HasSuffix(typed, "%") {
+			return intstr.FromString(typed)
+		}
+	case intstr.IntOrString:
+		return typed
+	}
+	panic(fmt.Sprintf("expected an int or a percentage, got %v", value))
+}
@@ -0,0 +1,144 @@
+package kube_builders
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/pkg/apis/extensions/v1beta1"
+)
+
+// kinds accepted by the workload operations on KubeTarget
+const (
+	KindDeployment            = "Deployment"
+	KindDaemonSet             = "DaemonSet"
+	KindReplicaSet            = "ReplicaSet"
+	KindReplicationController = "ReplicationController"
+)
+
+const (
+	// the annotation kubectl rollout restart sets, reused so both restart pods the same way
+	restartedAtAnnotation = "kubectl.kubernetes.io/restartedAt"
+
+	// daemon sets can't be paused, so Pause switches them to OnDelete and keeps the old strategy here. It
+	// is state rather than provenance, and is kept when a paused daemon set is pushed.
+	pausedStrategyAnnotation = "daemonset.kube-builders/paused-update-strategy"
+)
+
+// Scale sets the replicas of a workload through its scale subresource, without touching anything else
+// about it.
+func (kube *KubeTarget) Scale(kind, name, namespace string, replicas int) (err error) {
+	scales := kube.iface.ExtensionsV1beta1().Scales(namespace)
+	scale, err := scales.Get(kind, name)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get scale of %s %s", kind, name)
+	}
+	if scale.Spec.Replicas == int32(replicas) || kube.IsDryRun() {
+		return
+	}
+
+	scale.Spec.Replicas = int32(replicas)
+	_, err = scales.Update(kind, scale)
+	if err != nil {
+		err = errors.Wrapf(err, "failed to scale %s %s to %d", kind, name, replicas)
+	}
+	return
+}
+
+// Pause stops a deployment or daemon set from rolling out changes to its pod template until Resume is
+// called.
+func (kube *KubeTarget) Pause(kind, name, namespace string) error {
+	switch kind {
+	case KindDeployment:
+		return deploymentClient(namespace, kube.iface).modify(name, kube.dryRun, func(obj runtime.Object) error {
+			obj.(*v1beta1.Deployment).Spec.Paused = true
+			return nil
+		})
+	case KindDaemonSet:
+		return daemonSetClient(namespace, kube.iface).modify(name, kube.dryRun, func(obj runtime.Object) (err error) {
+			ds := obj.(*v1beta1.DaemonSet)
+			if ds.Spec.UpdateStrategy.Type == v1beta1.OnDeleteDaemonSetStrategyType {
+				return
+			}
+			var previous []byte
+			if previous, err = json.Marshal(ds.Spec.UpdateStrategy); err != nil {
+				return
+			}
+			setAtMap(&ds.Annotations, pausedStrategyAnnotation, string(previous))
+			ds.Spec.UpdateStrategy = v1beta1.DaemonSetUpdateStrategy{Type: v1beta1.OnDeleteDaemonSetStrategyType}
+			return
+		})
+	}
+	return errors.Errorf("can't pause a %s", kind)
+}
+
+func (kube *KubeTarget) Resume(kind, name, namespace string) error {
+	switch kind {
+	case KindDeployment:
+		return deploymentClient(namespace, kube.iface).modify(name, kube.dryRun, func(obj runtime.Object) error {
+			obj.(*v1beta1.Deployment).Spec.Paused = false
+			return nil
+		})
+	case KindDaemonSet:
+		return daemonSetClient(namespace, kube.iface).modify(name, kube.dryRun, func(obj runtime.Object) (err error) {
+			ds := obj.(*v1beta1.DaemonSet)
+			previous, paused := ds.Annotations[pausedStrategyAnnotation]
+			if !paused {
+				return
+			}
+			var strategy v1beta1.DaemonSetUpdateStrategy
+			if err = json.Unmarshal([]byte(previous), &strategy); err != nil {
+				return errors.Wrapf(err, "invalid %s annotation on daemon set %s", pausedStrategyAnnotation, name)
+			}
+			delete(ds.Annotations, pausedStrategyAnnotation)
+			ds.Spec.UpdateStrategy = strategy
+			return
+		})
+	}
+	return errors.Errorf("can't resume a %s", kind)
+}
+
+// Restart replaces every pod of a deployment or daemon set through a regular rollout, like kubectl
+// rollout restart.
+func (kube *KubeTarget) Restart(kind, name, namespace string) error {
+	restartedAt := time.Now().UTC().Format(time.RFC3339)
+	restart := func(template *v1.PodTemplateSpec) {
+		setAtMap(&template.Annotations, restartedAtAnnotation, restartedAt)
+	}
+
+	switch kind {
+	case KindDeployment:
+		return deploymentClient(namespace, kube.iface).modify(name, kube.dryRun, func(obj runtime.Object) error {
+			restart(&obj.(*v1beta1.Deployment).Spec.Template)
+			return nil
+		})
+	case KindDaemonSet:
+		return daemonSetClient(namespace, kube.iface).modify(name, kube.dryRun, func(obj runtime.Object) error {
+			restart(&obj.(*v1beta1.DaemonSet).Spec.Template)
+			return nil
+		})
+	}
+	return errors.Errorf("can't restart a %s", kind)
+}
+
+// keepPaused keeps a daemon set paused by Pause when it is pushed again. The pushed update strategy is
+// held back in the annotation instead, to be applied by Resume.
+func keepPaused(live, desired *v1beta1.DaemonSet) {
+	if _, paused := live.Annotations[pausedStrategyAnnotation]; !paused {
+		return
+	}
+	// a strategy is plain data, encoding it can't fail
+	strategy, _ := json.Marshal(desired.Spec.UpdateStrategy)
+	desired.Annotations = copyMap(desired.Annotations)
+	setAtMap(&desired.Annotations, pausedStrategyAnnotation, string(strategy))
+	desired.Spec.UpdateStrategy = v1beta1.DaemonSetUpdateStrategy{Type: v1beta1.OnDeleteDaemonSetStrategyType}
+}
+
+// keepRestartedAt carries a restart requested through Restart over to a template being pushed, which
+// would otherwise drop the annotation and roll every pod again.
+func keepRestartedAt(live, desired *meta_v1.ObjectMeta) {
+	keepAnnotations(live, desired, restartedAtAnnotation)
+}
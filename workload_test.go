@@ -0,0 +1,146 @@
+package kube_builders_test
+
+import (
+	. "github.com/Twister915/kube_builders"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/pkg/apis/extensions/v1beta1"
+	core "k8s.io/client-go/testing"
+)
+
+var _ = Describe("Workload Operations", func() {
+	const (
+		namespace = "test"
+		name      = "test"
+		restarted = "kubectl.kubernetes.io/restartedAt"
+
+		pausedStrategy = "daemonset.kube-builders/paused-update-strategy"
+	)
+
+	var (
+		fakeKubernetes *fake.Clientset
+		kubeTarget     *KubeTarget
+	)
+
+	pod := func() PodBuilder {
+		return kubeTarget.NewPod("", namespace).Container("web", "image", func(ctr ContainerBuilder) ContainerBuilder {
+			return ctr
+		})
+	}
+
+	getDeployment := func() *v1beta1.Deployment {
+		deployment, err := fakeKubernetes.ExtensionsV1beta1().Deployments(namespace).Get(name, meta_v1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		return deployment
+	}
+
+	getDaemonSet := func() *v1beta1.DaemonSet {
+		ds, err := fakeKubernetes.ExtensionsV1beta1().DaemonSets(namespace).Get(name, meta_v1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		return ds
+	}
+
+	BeforeEach(func() {
+		fakeKubernetes = fake.NewSimpleClientset()
+		kubeTarget = NewKubeTarget(fakeKubernetes)
+	})
+
+	It("scales through the scale subresource", func() {
+		var updated *v1beta1.Scale
+		fakeKubernetes.PrependReactor("*", "*", func(action core.Action) (bool, runtime.Object, error) {
+			if action.GetSubresource() != "scale" {
+				return false, nil, nil
+			}
+			if update, ok := action.(core.UpdateAction); ok {
+				updated = update.GetObject().(*v1beta1.Scale)
+				return true, updated, nil
+			}
+			scale := &v1beta1.Scale{Spec: v1beta1.ScaleSpec{Replicas: 1}}
+			scale.Name = name
+			scale.Namespace = namespace
+			return true, scale, nil
+		})
+
+		Expect(kubeTarget.Scale(KindDeployment, name, namespace, 5)).To(Succeed())
+		Expect(updated).ToNot(BeNil())
+		Expect(updated.Spec.Replicas).To(BeEquivalentTo(5))
+	})
+
+	It("pauses and resumes deployments", func() {
+		_, _, err := pod().Deployment(name).Push()
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(kubeTarget.Pause(KindDeployment, name, namespace)).To(Succeed())
+		Expect(getDeployment().Spec.Paused).To(BeTrue())
+
+		Expect(kubeTarget.Resume(KindDeployment, name, namespace)).To(Succeed())
+		Expect(getDeployment().Spec.Paused).To(BeFalse())
+	})
+
+	It("pauses daemon sets by holding back their updates", func() {
+		_, _, err := pod().DaemonSet(name).RollingUpdate(2).Push()
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(kubeTarget.Pause(KindDaemonSet, name, namespace)).To(Succeed())
+		Expect(getDaemonSet().Spec.UpdateStrategy.Type).To(Equal(v1beta1.OnDeleteDaemonSetStrategyType))
+
+		Expect(kubeTarget.Resume(KindDaemonSet, name, namespace)).To(Succeed())
+		ds := getDaemonSet()
+		Expect(ds.Spec.UpdateStrategy.Type).To(Equal(v1beta1.RollingUpdateDaemonSetStrategyType))
+		Expect(ds.Spec.UpdateStrategy.RollingUpdate.MaxUnavailable.IntValue()).To(Equal(2))
+		Expect(ds.Annotations).ToNot(HaveKey(pausedStrategy))
+	})
+
+	It("keeps deployments paused when they are pushed again", func() {
+		_, _, err := pod().Deployment(name).Push()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(kubeTarget.Pause(KindDeployment, name, namespace)).To(Succeed())
+
+		deployment, _, err := pod().Deployment(name).Replicas(3).Push()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(deployment.Spec.Paused).To(BeTrue())
+
+		By("resuming when the builder says so")
+		deployment, _, err = pod().Deployment(name).Replicas(3).Paused(false).Push()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(deployment.Spec.Paused).To(BeFalse())
+	})
+
+	It("keeps daemon sets paused when they are pushed again", func() {
+		_, _, err := pod().DaemonSet(name).RollingUpdate(2).Push()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(kubeTarget.Pause(KindDaemonSet, name, namespace)).To(Succeed())
+
+		ds, _, err := pod().DaemonSet(name).RollingUpdate(3).Push()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ds.Spec.UpdateStrategy.Type).To(Equal(v1beta1.OnDeleteDaemonSetStrategyType))
+		Expect(ds.Annotations).To(HaveKey(pausedStrategy))
+
+		By("applying the pushed strategy on resume")
+		Expect(kubeTarget.Resume(KindDaemonSet, name, namespace)).To(Succeed())
+		ds = getDaemonSet()
+		Expect(ds.Spec.UpdateStrategy.Type).To(Equal(v1beta1.RollingUpdateDaemonSetStrategyType))
+		Expect(ds.Spec.UpdateStrategy.RollingUpdate.MaxUnavailable.IntValue()).To(Equal(3))
+	})
+
+	It("restarts without the next push undoing it", func() {
+		_, _, err := pod().Deployment(name).Push()
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(kubeTarget.Restart(KindDeployment, name, namespace)).To(Succeed())
+		Expect(getDeployment().Spec.Template.Annotations).To(HaveKey(restarted))
+
+		deployment, _, err := pod().Deployment(name).Replicas(3).Push()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(deployment.Spec.Template.Annotations).To(HaveKey(restarted))
+	})
+
+	It("refuses kinds it can't handle", func() {
+		Expect(kubeTarget.Pause(KindReplicaSet, name, namespace)).ToNot(Succeed())
+		Expect(kubeTarget.Restart(KindReplicationController, name, namespace)).ToNot(Succeed())
+	})
+})